@@ -0,0 +1,289 @@
+// Command gfxfont converts bitmap fonts into Go source files that define a *gfx.Font.
+//
+// The font can be a PNG image with the glyphs arranged in a grid of equally sized cells,
+// a BDF font or a PSF font, optionally gzip compressed. The generated source uses the same
+// annotated layout as the built-in fonts of the gfx package.
+//
+// Usage:
+//
+//	gfxfont [flags] font-file
+//
+// Examples:
+//
+//	gfxfont -name Font8x14 -o font8x14.go vga8x14.psf.gz
+//	gfxfont -pkg assets -name TitleFont -cell 12x16 -first 32 -o titlefont.go title.png
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"image"
+	_ "image/png" // imported to register the png image decoder used to load glyph grids
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/taylorza/go-gfx/pkg/gfx"
+)
+
+var (
+	name   = flag.String("name", "", "name of the font variable, defaults to FontWxH outside of the gfx package")
+	pkg    = flag.String("pkg", "gfx", "package name of the generated source")
+	output = flag.String("o", "", "output file, defaults to standard output")
+	cell   = flag.String("cell", "8x8", "glyph cell size of a PNG glyph grid")
+	first  = flag.Int("first", 32, "character of the first glyph of a PNG glyph grid")
+	invert = flag.Bool("invert", false, "treat dark pixels of a PNG glyph grid as set instead of light pixels")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: gfxfont [flags] font-file\n\nflags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0)); err != nil {
+		fmt.Fprintf(os.Stderr, "gfxfont: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(filename string) error {
+	font, err := loadFont(filename)
+	if err != nil {
+		return err
+	}
+
+	varName := *name
+	if varName == "" {
+		varName = fmt.Sprintf("Font%dx%d", font.W, font.H)
+	}
+	if *pkg == "gfx" && builtinFonts[varName] {
+		return fmt.Errorf("%s is a built-in font of the gfx package, choose another name with -name", varName)
+	}
+
+	src, err := generate(font, *pkg, varName, filepath.Base(filename))
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(*output, src, 0644)
+}
+
+// builtinFonts are the names of the fonts defined by the gfx package
+var builtinFonts = map[string]bool{
+	"Font4x6":     true,
+	"Font5x8":     true,
+	"Font6x8":     true,
+	"Font6x8Ati":  true,
+	"Font8x8":     true,
+	"Font8x8Bold": true,
+	"Font8x16":    true,
+}
+
+func loadFont(filename string) (*gfx.Font, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == ".gz" {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+		ext = strings.ToLower(filepath.Ext(strings.TrimSuffix(filename, filepath.Ext(filename))))
+	}
+
+	switch ext {
+	case ".bdf":
+		return gfx.LoadBDF(r)
+	case ".psf", ".psfu":
+		return gfx.LoadPSF(r)
+	case ".png":
+		return loadGlyphGrid(r)
+	}
+	return nil, fmt.Errorf("unsupported font file %q, expected .png, .bdf or .psf", filename)
+}
+
+// loadGlyphGrid creates a font from an image with the glyphs arranged left to right, top to bottom
+// in a grid of equally sized cells.
+func loadGlyphGrid(r io.Reader) (*gfx.Font, error) {
+	var w, h int
+	if _, err := fmt.Sscanf(*cell, "%dx%d", &w, &h); err != nil || w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("invalid cell size %q", *cell)
+	}
+
+	m, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	b := m.Bounds()
+	cols := b.Dx() / w
+	rows := b.Dy() / h
+	if cols == 0 || rows == 0 {
+		return nil, errors.New("image is smaller than a single glyph cell")
+	}
+
+	rowBytes := (w + 7) / 8
+	chars := make([]rune, 0, cols*rows)
+	data := make([]byte, cols*rows*rowBytes*h)
+	i := 0
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			chars = append(chars, rune(*first+len(chars)))
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					if isSet(m, b.Min.X+col*w+x, b.Min.Y+row*h+y) {
+						data[i+y*rowBytes+x/8] |= 0x80 >> (x % 8)
+					}
+				}
+			}
+			i += rowBytes * h
+		}
+	}
+	return gfx.NewFont(w, h, chars, data, nil)
+}
+
+// isSet returns true if the pixel at x, y of a glyph grid is part of a glyph
+func isSet(m image.Image, x, y int) bool {
+	r, g, b, a := m.At(x, y).RGBA()
+	if a < 0x8000 {
+		return false
+	}
+	light := (r+g+b)/3 >= 0x8000
+	return light != *invert
+}
+
+func generate(font *gfx.Font, pkgName, varName, source string) ([]byte, error) {
+	chars := font.Chars()
+	// Fonts that cover a consecutive range of bytes without metrics are written as a struct literal
+	// when generated into the gfx package, exactly like the built-in fonts.
+	literal := pkgName == "gfx" && font.Monospaced() && isDense(chars)
+	qualifier := "gfx."
+	if pkgName == "gfx" {
+		qualifier = ""
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by gfxfont from %s. DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&buf, "package %s\n\n", pkgName)
+	if qualifier != "" {
+		fmt.Fprintf(&buf, "import \"github.com/taylorza/go-gfx/pkg/gfx\"\n\n")
+	}
+	fmt.Fprintf(&buf, "// %s %d x %d raster font\n", varName, font.W, font.H)
+
+	if literal {
+		fmt.Fprintf(&buf, "var %s = &Font{\n", varName)
+		fmt.Fprintf(&buf, "\tW: %d,\n\tH: %d,\n\tFirstChar: %d,\n\tLastChar: %d,\n", font.W, font.H, chars[0], chars[len(chars)-1])
+		fmt.Fprintf(&buf, "\tDefaultChar: %d,\n", font.DefaultChar)
+		fmt.Fprintf(&buf, "\tdata: []byte{\n")
+		writeGlyphs(&buf, font, chars)
+		fmt.Fprintf(&buf, "\t},\n}\n")
+	} else {
+		// The generated glyphs always describe a valid font, the error is only checked to satisfy NewFont
+		fmt.Fprintf(&buf, "var %s = func() *%sFont {\n", varName, qualifier)
+		fmt.Fprintf(&buf, "f, err := %sNewFont(%d, %d,\n", qualifier, font.W, font.H)
+		fmt.Fprintf(&buf, "\t[]rune{")
+		for i, ch := range chars {
+			if i%16 == 0 {
+				fmt.Fprintf(&buf, "\n\t\t")
+			}
+			fmt.Fprintf(&buf, "%d, ", ch)
+		}
+		fmt.Fprintf(&buf, "\n\t},\n")
+		fmt.Fprintf(&buf, "\t[]byte{\n")
+		writeGlyphs(&buf, font, chars)
+		fmt.Fprintf(&buf, "\t},\n")
+		if font.Monospaced() {
+			fmt.Fprintf(&buf, "\tnil,\n")
+		} else {
+			fmt.Fprintf(&buf, "\t[]%sGlyphMetrics{\n", qualifier)
+			for _, ch := range chars {
+				m := font.GlyphMetrics(ch)
+				fmt.Fprintf(&buf, "\t\t{Advance: %d, Bearing: %d}, // code=%d\n", m.Advance, m.Bearing, ch)
+			}
+			fmt.Fprintf(&buf, "\t},\n")
+		}
+		fmt.Fprintf(&buf, ")\n")
+		fmt.Fprintf(&buf, "if err != nil {\npanic(err)\n}\n")
+		fmt.Fprintf(&buf, "f.DefaultChar = %d\n", font.DefaultChar)
+		fmt.Fprintf(&buf, "return f\n}()\n")
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+// isDense returns true if chars is a consecutive range of characters in the byte range
+func isDense(chars []rune) bool {
+	if len(chars) == 0 {
+		return false
+	}
+	for i, ch := range chars {
+		if ch != chars[0]+rune(i) || ch > 255 {
+			return false
+		}
+	}
+	return true
+}
+
+// writeGlyphs writes the bitmap of each glyph annotated with the character code and the bit pattern of each row
+func writeGlyphs(w io.Writer, font *gfx.Font, chars []rune) {
+	rowBytes := (font.W + 7) / 8
+	for i, ch := range chars {
+		if i > 0 {
+			fmt.Fprintf(w, "\n")
+		}
+		fmt.Fprintf(w, "\t\t// code=%d, hex=0x%02X, %s\n", ch, ch, charLabel(ch))
+		glyph := font.Glyph(ch)
+		for y := 0; y < font.H; y++ {
+			row := glyph[y*rowBytes : (y+1)*rowBytes]
+			fmt.Fprintf(w, "\t\t")
+			for _, b := range row {
+				fmt.Fprintf(w, "0x%02X, ", b)
+			}
+			fmt.Fprintf(w, "/* ")
+			for x := 0; x < rowBytes*8; x++ {
+				if row[x/8]&(0x80>>(x%8)) != 0 {
+					fmt.Fprintf(w, "1")
+				} else {
+					fmt.Fprintf(w, "0")
+				}
+			}
+			fmt.Fprintf(w, " */\n")
+		}
+	}
+}
+
+// charLabel returns the annotation used to identify the character of a glyph
+func charLabel(ch rune) string {
+	switch {
+	case ch > 32 && ch < 127:
+		return fmt.Sprintf("ascii='%c'", ch)
+	case ch <= 255:
+		return fmt.Sprintf("ascii='^%d'", ch)
+	case unicode.IsPrint(ch):
+		return fmt.Sprintf("unicode='%c'", ch)
+	}
+	return fmt.Sprintf("unicode='^%d'", ch)
+}
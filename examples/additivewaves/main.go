@@ -4,6 +4,7 @@
 package main
 
 import (
+	"log"
 	"math/rand"
 
 	"github.com/taylorza/go-gfx/pkg/gfx"
@@ -45,7 +46,10 @@ func (app *myapp) Update(delta float64) {
 }
 
 func main() {
-	if gfx.Init("Additive Waves", 0, 0, 600, 400, 1, 1) {
-		gfx.Run(&myapp{})
+	if err := gfx.Init("Additive Waves", 0, 0, 600, 400, 1, 1); err != nil {
+		log.Fatal(err)
+	}
+	if err := gfx.Run(&myapp{}); err != nil {
+		log.Fatal(err)
 	}
 }
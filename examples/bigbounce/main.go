@@ -1,7 +1,9 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"log"
 	"math"
 	"math/rand"
 
@@ -69,16 +71,45 @@ func (app *myapp) Update(delta float64) {
 		}
 	}
 
+	if gfx.KeyPressed(gfx.KeyAlt) && gfx.KeyJustPressed(gfx.KeyReturn) {
+		gfx.SetFullscreen(!gfx.Fullscreen())
+	}
+
 	gfx.DrawString(gfx.Font8x8, 8, 8, "Press SPACE to add balls", gfx.Black, gfx.Grey)
-	gfx.DrawString(gfx.Font8x8, 8, 16, fmt.Sprintf("Balls: %v", len(app.balls)), gfx.Black, gfx.Grey)
+	gfx.DrawString(gfx.Font8x8, 8, 16, "Press ALT+ENTER to toggle fullscreen", gfx.Black, gfx.Grey)
+	gfx.DrawString(gfx.Font8x8, 8, 24, fmt.Sprintf("Balls: %v", len(app.balls)), gfx.Black, gfx.Grey)
+
+	stats := gfx.FrameTimeStats()
+	gfx.DrawString(gfx.Font8x8, 8, 32, fmt.Sprintf("Present: %.2fms Busy: %.2fms", stats.Present*1000, stats.Busy*1000), gfx.Black, gfx.Grey)
 }
 
 func (app *myapp) Unload() {
-
+	// The present time runs until the X server has read the pixels of the frame, it is comparable between the runs
+	stats := gfx.FrameTimeStats()
+	log.Printf("present %.2fms (shared memory disabled: %v)", stats.Present*1000, *noshm)
 }
 
+// Compare the present times with and without shared memory on a local X server by running with -noshm,
+// the average present time is logged on exit
+var noshm = flag.Bool("noshm", false, "present the frames without shared memory")
+
 func main() {
-	if gfx.Init("GFX Big Bounce", 10, 10, 320, 240, 2, 2) {
-		gfx.Run(&myapp{})
+	flag.Parse()
+	err := gfx.InitWithConfig(gfx.Config{
+		Title:          "GFX Big Bounce",
+		X:              10,
+		Y:              10,
+		Width:          320,
+		Height:         240,
+		ScaleX:         2,
+		ScaleY:         2,
+		VSync:          true,
+		NoSharedMemory: *noshm,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := gfx.Run(&myapp{}); err != nil {
+		log.Fatal(err)
 	}
 }
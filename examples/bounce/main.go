@@ -1,6 +1,8 @@
 package main
 
 import (
+	"log"
+
 	"github.com/taylorza/go-gfx/pkg/gfx"
 )
 
@@ -41,7 +43,10 @@ func (app *myapp) Unload() {
 }
 
 func main() {
-	if gfx.Init("GFX Bounce", 10, 10, 320, 240, 2, 2) {
-		gfx.Run(&myapp{})
+	if err := gfx.Init("GFX Bounce", 10, 10, 320, 240, 2, 2); err != nil {
+		log.Fatal(err)
+	}
+	if err := gfx.Run(&myapp{}); err != nil {
+		log.Fatal(err)
 	}
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"log"
+
 	"github.com/taylorza/go-gfx/pkg/gfx"
 )
 
@@ -40,7 +42,10 @@ func (app *myapp) Update(delta float64) {
 }
 
 func main() {
-	if gfx.Init("Mouse Demo", 0, 0, 640, 480, 2, 2) {
-		gfx.Run(&myapp{})
+	if err := gfx.Init("Mouse Demo", 0, 0, 640, 480, 2, 2); err != nil {
+		log.Fatal(err)
+	}
+	if err := gfx.Run(&myapp{}); err != nil {
+		log.Fatal(err)
 	}
 }
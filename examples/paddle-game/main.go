@@ -100,8 +100,11 @@ func main() {
 		time.Sleep(20 * time.Second)
 	}()
 
-	if gfx.Init("GFX Paddle Game", 10, 10, 800, 600, 1, 1) {
-		gfx.Run(&myapp{})
+	if err := gfx.Init("GFX Paddle Game", 10, 10, 800, 600, 1, 1); err != nil {
+		log.Fatal(err)
+	}
+	if err := gfx.Run(&myapp{}); err != nil {
+		log.Fatal(err)
 	}
 
 	if *memprofile != "" {
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"log"
+
 	"github.com/taylorza/go-gfx/pkg/gfx"
 )
 
+var filterNames = []string{"Nearest", "Bilinear", "Scanlines", "CRT", "Scale2x", "HQ2x"}
+
 type myapp struct {
 	screen int
+	filter gfx.PresentFilter
 }
 
 func (app *myapp) Load() {
@@ -15,7 +20,8 @@ func (app *myapp) Update(delta float64) {
 	gfx.Clear(gfx.Cyan)
 
 	gfx.DrawString(gfx.Font6x8Ati, 109, 4, "GO GFX Primitives", gfx.Transparent, gfx.Black)
-	gfx.DrawString(gfx.Font6x8Ati, 73, 16, "Press SPACE to toggle display", gfx.Transparent, gfx.Black)
+	gfx.DrawRichString(gfx.Font6x8Ati, 73, 16, "Press [c=red]SPACE[/c] to toggle display", gfx.RichColors(gfx.Transparent, gfx.Black))
+	gfx.DrawRichString(gfx.Font6x8Ati, 73, 28, "Press [c=red]F[/c] to change filter: "+filterNames[app.filter], gfx.RichColors(gfx.Transparent, gfx.Black))
 
 	if gfx.KeyJustPressed(gfx.KeySpace) {
 		app.screen++
@@ -23,6 +29,10 @@ func (app *myapp) Update(delta float64) {
 			app.screen = 0
 		}
 	}
+	if gfx.KeyJustPressed(gfx.KeyF) {
+		app.filter = (app.filter + 1) % gfx.PresentFilter(len(filterNames))
+		gfx.SetPresentFilter(app.filter)
+	}
 	if app.screen == 0 {
 		gfx.DrawCircle(gfx.Width()/2, gfx.Height()/2, gfx.Height()/3, gfx.Red)
 		gfx.DrawRect(gfx.Width()/2-50, gfx.Height()/2-50, 100, 100, gfx.Yellow)
@@ -41,7 +51,10 @@ func (app *myapp) Unload() {
 }
 
 func main() {
-	if gfx.Init("GFX Primitives", 10, 10, 320, 240, 2, 2) {
-		gfx.Run(&myapp{})
+	if err := gfx.Init("GFX Primitives", 10, 10, 320, 240, 2, 2); err != nil {
+		log.Fatal(err)
+	}
+	if err := gfx.Run(&myapp{}); err != nil {
+		log.Fatal(err)
 	}
 }
@@ -0,0 +1,144 @@
+//go:build linux
+// +build linux
+
+package evdev
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	iocRead     = 2
+	absInfoSize = int(unsafe.Sizeof(AbsInfo{}))
+)
+
+// ioc encodes an ioctl request of the evdev driver that reads size bytes. The request is computed unsigned,
+// the direction bits do not fit an int on 32-bit platforms.
+func ioc(nr, size int) uintptr {
+	return uintptr(iocRead)<<30 | uintptr(size)<<16 | uintptr('E')<<8 | uintptr(nr)
+}
+
+// Device is an open evdev device
+type Device struct {
+	f    *os.File
+	name string
+	keys []byte
+	abs  map[uint16]AbsInfo
+}
+
+// Open opens the evdev device at path, for example /dev/input/event0, and queries its name and capabilities
+func Open(path string) (*Device, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	d := &Device{
+		f:    f,
+		keys: make([]byte, KeyMax/8+1),
+		abs:  make(map[uint16]AbsInfo),
+	}
+	if err := d.query(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// control runs f with the file descriptor of the device and an ioctl function that keeps the first error
+func (d *Device) control(f func(fd uintptr, ioctl func(fd, req uintptr, p unsafe.Pointer))) error {
+	rc, err := d.f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var ioctlErr error
+	ioctl := func(fd, req uintptr, p unsafe.Pointer) {
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(p)); errno != 0 && ioctlErr == nil {
+			ioctlErr = errno
+		}
+	}
+	if err := rc.Control(func(fd uintptr) { f(fd, ioctl) }); err != nil {
+		return err
+	}
+	return ioctlErr
+}
+
+func (d *Device) query() error {
+	return d.control(func(fd uintptr, ioctl func(fd, req uintptr, p unsafe.Pointer)) {
+		name := make([]byte, 256)
+		ioctl(fd, ioc(0x06, len(name)), unsafe.Pointer(&name[0]))
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		d.name = string(name)
+
+		ioctl(fd, ioc(0x20+EvKey, len(d.keys)), unsafe.Pointer(&d.keys[0]))
+
+		absBits := make([]byte, AbsMax/8+1)
+		ioctl(fd, ioc(0x20+EvAbs, len(absBits)), unsafe.Pointer(&absBits[0]))
+		for code := 0; code <= AbsMax; code++ {
+			if absBits[code/8]&(1<<(code%8)) != 0 {
+				var info AbsInfo
+				ioctl(fd, ioc(0x40+code, absInfoSize), unsafe.Pointer(&info))
+				d.abs[uint16(code)] = info
+			}
+		}
+	})
+}
+
+// State reads the current state of the buttons and absolute axes of the device. It is used to resynchronize
+// a Gamepad after the device dropped events.
+func (d *Device) State() (State, error) {
+	s := State{
+		Buttons: make(map[uint16]bool),
+		Axes:    make(map[uint16]int32),
+	}
+	err := d.control(func(fd uintptr, ioctl func(fd, req uintptr, p unsafe.Pointer)) {
+		keys := make([]byte, len(d.keys))
+		ioctl(fd, ioc(0x18, len(keys)), unsafe.Pointer(&keys[0]))
+		for code := 0; code < len(keys)*8; code++ {
+			if d.keys[code/8]&(1<<(code%8)) != 0 {
+				s.Buttons[uint16(code)] = keys[code/8]&(1<<(code%8)) != 0
+			}
+		}
+		for code := range d.abs {
+			var info AbsInfo
+			ioctl(fd, ioc(0x40+int(code), absInfoSize), unsafe.Pointer(&info))
+			s.Axes[code] = info.Value
+		}
+	})
+	return s, err
+}
+
+// Name returns the name reported by the device
+func (d *Device) Name() string {
+	return d.name
+}
+
+// AbsInfo returns the ranges of the absolute axes of the device
+func (d *Device) AbsInfo() map[uint16]AbsInfo {
+	return d.abs
+}
+
+// HasButton returns true if the device reports the button or key with the code
+func (d *Device) HasButton(code uint16) bool {
+	return int(code) < len(d.keys)*8 && d.keys[code/8]&(1<<(code%8)) != 0
+}
+
+// IsGamepad returns true if the device has the buttons and axes of a gamepad or joystick
+func (d *Device) IsGamepad() bool {
+	return (d.HasButton(BtnGamepad) || d.HasButton(BtnJoystick)) && len(d.abs) > 0
+}
+
+// Read reads encoded events from the device, use a Reader to decode them
+func (d *Device) Read(p []byte) (int, error) {
+	return d.f.Read(p)
+}
+
+// Close closes the device
+func (d *Device) Close() error {
+	return d.f.Close()
+}
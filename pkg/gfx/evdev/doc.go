@@ -0,0 +1,6 @@
+// Package evdev decodes the input events of Linux evdev devices, as read from /dev/input/event*.
+// The gfx package uses it to read gamepads and joysticks.
+//
+// The decoding works on any io.Reader, so recorded event streams can be decoded on any platform
+// without the device. Opening devices is only supported on Linux.
+package evdev
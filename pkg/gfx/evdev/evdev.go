@@ -0,0 +1,127 @@
+package evdev
+
+import (
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"time"
+)
+
+// Event types
+const (
+	EvSyn = 0x00
+	EvKey = 0x01
+	EvAbs = 0x03
+)
+
+// Synchronization event codes
+const (
+	SynReport  = 0
+	SynDropped = 3
+)
+
+// Button codes of joysticks and gamepads
+const (
+	BtnJoystick  = 0x120
+	BtnGamepad   = 0x130
+	BtnSouth     = 0x130
+	BtnEast      = 0x131
+	BtnC         = 0x132
+	BtnNorth     = 0x133
+	BtnWest      = 0x134
+	BtnZ         = 0x135
+	BtnTL        = 0x136
+	BtnTR        = 0x137
+	BtnTL2       = 0x138
+	BtnTR2       = 0x139
+	BtnSelect    = 0x13a
+	BtnStart     = 0x13b
+	BtnMode      = 0x13c
+	BtnThumbL    = 0x13d
+	BtnThumbR    = 0x13e
+	BtnDPadUp    = 0x220
+	BtnDPadDown  = 0x221
+	BtnDPadLeft  = 0x222
+	BtnDPadRight = 0x223
+	KeyMax       = 0x2ff
+)
+
+// Absolute axis codes
+const (
+	AbsX     = 0x00
+	AbsY     = 0x01
+	AbsZ     = 0x02
+	AbsRX    = 0x03
+	AbsRY    = 0x04
+	AbsRZ    = 0x05
+	AbsGas   = 0x09
+	AbsBrake = 0x0a
+	AbsHat0X = 0x10
+	AbsHat0Y = 0x11
+	AbsMax   = 0x3f
+)
+
+// Sizes of an encoded event, which depend on the size of the time value of the platform
+const (
+	EventSize   = 24 // 64-bit platforms
+	EventSize32 = 16 // 32-bit platforms
+)
+
+// Event is an input event of a device
+type Event struct {
+	Time  time.Time
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// Reader decodes events from a stream of encoded events
+type Reader struct {
+	r    io.Reader
+	size int
+	buf  []byte
+}
+
+// NewReader creates a reader that decodes events using the event size of the platform
+func NewReader(r io.Reader) *Reader {
+	if bits.UintSize == 32 {
+		return NewReaderSize(r, EventSize32)
+	}
+	return NewReaderSize(r, EventSize)
+}
+
+// NewReaderSize creates a reader that decodes events of the specified size, either EventSize or EventSize32.
+// This is used to decode events recorded on another platform.
+func NewReaderSize(r io.Reader, eventSize int) *Reader {
+	return &Reader{
+		r:    r,
+		size: eventSize,
+		buf:  make([]byte, eventSize),
+	}
+}
+
+// ReadEvent reads the next event. The events are decoded as little endian, the byte order of the
+// platforms supported by gfx.
+func (r *Reader) ReadEvent() (Event, error) {
+	if _, err := io.ReadFull(r.r, r.buf); err != nil {
+		return Event{}, err
+	}
+
+	var sec, usec int64
+	b := r.buf
+	if r.size == EventSize32 {
+		sec = int64(int32(binary.LittleEndian.Uint32(b[0:])))
+		usec = int64(int32(binary.LittleEndian.Uint32(b[4:])))
+		b = b[8:]
+	} else {
+		sec = int64(binary.LittleEndian.Uint64(b[0:]))
+		usec = int64(binary.LittleEndian.Uint64(b[8:]))
+		b = b[16:]
+	}
+	return Event{
+		Time:  time.Unix(sec, usec*1000),
+		Type:  binary.LittleEndian.Uint16(b[0:]),
+		Code:  binary.LittleEndian.Uint16(b[2:]),
+		Value: int32(binary.LittleEndian.Uint32(b[4:])),
+	}, nil
+}
@@ -0,0 +1,170 @@
+package evdev
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+)
+
+// encode encodes events as a device of the specified event size writes them
+func encode(size int, events ...Event) []byte {
+	var buf bytes.Buffer
+	for _, ev := range events {
+		b := make([]byte, size)
+		sec, usec := ev.Time.Unix(), int64(ev.Time.Nanosecond()/1000)
+		t := b[16:]
+		if size == EventSize32 {
+			binary.LittleEndian.PutUint32(b[0:], uint32(sec))
+			binary.LittleEndian.PutUint32(b[4:], uint32(usec))
+			t = b[8:]
+		} else {
+			binary.LittleEndian.PutUint64(b[0:], uint64(sec))
+			binary.LittleEndian.PutUint64(b[8:], uint64(usec))
+		}
+		binary.LittleEndian.PutUint16(t[0:], ev.Type)
+		binary.LittleEndian.PutUint16(t[2:], ev.Code)
+		binary.LittleEndian.PutUint32(t[4:], uint32(ev.Value))
+		buf.Write(b)
+	}
+	return buf.Bytes()
+}
+
+func key(code uint16, value int32) Event {
+	return Event{Type: EvKey, Code: code, Value: value}
+}
+
+func abs(code uint16, value int32) Event {
+	return Event{Type: EvAbs, Code: code, Value: value}
+}
+
+func syn(code uint16) Event {
+	return Event{Type: EvSyn, Code: code}
+}
+
+// replay decodes the stream and applies it to the gamepad, returning the number of changes reported
+func replay(t *testing.T, g *Gamepad, r *Reader) int {
+	t.Helper()
+	changes := 0
+	for {
+		ev, err := r.ReadEvent()
+		if err == io.EOF {
+			return changes
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.Process(ev) {
+			changes++
+		}
+	}
+}
+
+func TestReaderDecodesBothEventSizes(t *testing.T) {
+	want := []Event{key(BtnSouth, 1), abs(AbsX, -1234), syn(SynReport)}
+	for _, size := range []int{EventSize, EventSize32} {
+		r := NewReaderSize(bytes.NewReader(encode(size, want...)), size)
+		for i, w := range want {
+			ev, err := r.ReadEvent()
+			if err != nil {
+				t.Fatalf("size %d event %d: %v", size, i, err)
+			}
+			if ev.Type != w.Type || ev.Code != w.Code || ev.Value != w.Value {
+				t.Errorf("size %d event %d = %+v, want %+v", size, i, ev, w)
+			}
+		}
+		if _, err := r.ReadEvent(); err != io.EOF {
+			t.Errorf("size %d: got %v at the end of the stream, want io.EOF", size, err)
+		}
+	}
+}
+
+func TestGamepadAppliesChangesOnReport(t *testing.T) {
+	g := NewGamepad(nil)
+	r := NewReaderSize(bytes.NewReader(encode(EventSize, key(BtnSouth, 1))), EventSize)
+	replay(t, g, r)
+	if g.Button(BtnSouth) {
+		t.Fatal("button pressed before the report")
+	}
+	g.Process(syn(SynReport))
+	if !g.Button(BtnSouth) {
+		t.Fatal("button not pressed after the report")
+	}
+}
+
+func TestGamepadStickRanges(t *testing.T) {
+	info := map[uint16]AbsInfo{
+		AbsX: {Minimum: 0, Maximum: 255},
+		AbsY: {Minimum: -32768, Maximum: 32767},
+		AbsZ: {Minimum: 0, Maximum: 255},
+	}
+	g := NewGamepad(info)
+	stream := encode(EventSize,
+		abs(AbsX, 0), abs(AbsY, 32767), abs(AbsZ, 0), syn(SynReport),
+		abs(AbsX, 128), abs(AbsZ, 255), syn(SynReport),
+		abs(AbsX, 255), syn(SynReport))
+	r := NewReaderSize(bytes.NewReader(stream), EventSize)
+
+	steps := []struct{ x, y, z float64 }{{-1, 1, 0}, {0, 1, 1}, {1, 1, 1}}
+	for i, want := range steps {
+		for {
+			ev, err := r.ReadEvent()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g.Process(ev) {
+				break
+			}
+		}
+		if x := g.Stick(AbsX); math.Abs(x-want.x) > 0.01 {
+			t.Errorf("step %d: 0..255 stick = %v, want %v", i, x, want.x)
+		}
+		if y := g.Stick(AbsY); math.Abs(y-want.y) > 0.01 {
+			t.Errorf("step %d: signed stick = %v, want %v", i, y, want.y)
+		}
+		if z := g.Trigger(AbsZ); math.Abs(z-want.z) > 0.01 {
+			t.Errorf("step %d: trigger = %v, want %v", i, z, want.z)
+		}
+	}
+}
+
+func TestGamepadResyncsAfterDroppedEvents(t *testing.T) {
+	g := NewGamepad(map[uint16]AbsInfo{AbsX: {Minimum: 0, Maximum: 255, Value: 128}})
+	stream := encode(EventSize,
+		key(BtnSouth, 1), key(BtnEast, 1), syn(SynReport),
+		// The release of BtnSouth is lost in the overrun
+		abs(AbsX, 0), syn(SynDropped),
+		abs(AbsX, 10), key(BtnEast, 0), syn(SynReport))
+	r := NewReaderSize(bytes.NewReader(stream), EventSize)
+
+	if n := replay(t, g, r); n != 1 {
+		t.Fatalf("%d changes reported, want only the report before the drop", n)
+	}
+	if !g.NeedsSync() {
+		t.Fatal("NeedsSync is false after dropped events")
+	}
+	if !g.Button(BtnEast) {
+		t.Fatal("changes up to the report after the drop were applied")
+	}
+
+	g.Sync(State{
+		Buttons: map[uint16]bool{BtnSouth: false, BtnEast: false},
+		Axes:    map[uint16]int32{AbsX: 255},
+	})
+	if g.NeedsSync() {
+		t.Error("NeedsSync is true after Sync")
+	}
+	if g.Button(BtnSouth) || g.Button(BtnEast) {
+		t.Error("buttons still pressed after Sync")
+	}
+	if x := g.Stick(AbsX); x != 1 {
+		t.Errorf("stick = %v after Sync, want 1", x)
+	}
+
+	// Events after the resync apply normally
+	g.Process(key(BtnSouth, 1))
+	if !g.Process(syn(SynReport)) || !g.Button(BtnSouth) {
+		t.Error("events after Sync not applied")
+	}
+}
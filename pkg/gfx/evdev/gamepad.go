@@ -0,0 +1,131 @@
+package evdev
+
+// AbsInfo describes the range of an absolute axis
+type AbsInfo struct {
+	Value      int32
+	Minimum    int32
+	Maximum    int32
+	Fuzz       int32
+	Flat       int32
+	Resolution int32
+}
+
+// State is the state of the buttons and absolute axes of a device
+type State struct {
+	Buttons map[uint16]bool
+	Axes    map[uint16]int32
+}
+
+// Gamepad tracks the state of the buttons and axes of a device from its events. Changes are applied
+// in complete sets, when the device reports the end of a set of changes with a SynReport event.
+type Gamepad struct {
+	abs       map[uint16]AbsInfo
+	buttons   map[uint16]bool
+	axes      map[uint16]int32
+	changes   []Event
+	dropped   bool
+	needsSync bool
+}
+
+// NewGamepad creates a gamepad with the ranges of its absolute axes. Axes without a range are assumed
+// to range from -32768 to 32767.
+func NewGamepad(abs map[uint16]AbsInfo) *Gamepad {
+	g := &Gamepad{
+		abs:     abs,
+		buttons: make(map[uint16]bool),
+		axes:    make(map[uint16]int32),
+	}
+	for code, info := range abs {
+		g.axes[code] = info.Value
+	}
+	return g
+}
+
+// Process applies an event to the state of the gamepad and returns true when the state changed.
+// When events were dropped by the device, the changes are discarded up to the next report, because the
+// state of the device is unknown. NeedsSync then returns true until the state is read from the device and
+// passed to Sync.
+func (g *Gamepad) Process(ev Event) bool {
+	switch ev.Type {
+	case EvSyn:
+		switch ev.Code {
+		case SynDropped:
+			g.dropped = true
+			g.changes = g.changes[:0]
+		case SynReport:
+			if g.dropped {
+				g.dropped = false
+				g.needsSync = true
+				return false
+			}
+			changed := len(g.changes) > 0
+			for _, c := range g.changes {
+				if c.Type == EvKey {
+					g.buttons[c.Code] = c.Value != 0
+				} else {
+					g.axes[c.Code] = c.Value
+				}
+			}
+			g.changes = g.changes[:0]
+			return changed
+		}
+	case EvKey, EvAbs:
+		if !g.dropped {
+			g.changes = append(g.changes, ev)
+		}
+	}
+	return false
+}
+
+// Button returns true if the button with the code is pressed
+func (g *Gamepad) Button(code uint16) bool {
+	return g.buttons[code]
+}
+
+// NeedsSync returns true when the device dropped events and the state of the gamepad is unknown
+func (g *Gamepad) NeedsSync() bool {
+	return g.needsSync
+}
+
+// Sync replaces the state of the gamepad with the state read from the device, see Device.State
+func (g *Gamepad) Sync(s State) {
+	for code, pressed := range s.Buttons {
+		g.buttons[code] = pressed
+	}
+	for code, v := range s.Axes {
+		g.axes[code] = v
+	}
+	g.changes = g.changes[:0]
+	g.needsSync = false
+}
+
+// Stick returns the position of a stick or hat axis from -1 to 1, centred on the middle of the range of the
+// axis. Devices report sticks in different ranges, for example -32768 to 32767 or 0 to 255.
+func (g *Gamepad) Stick(code uint16) float64 {
+	return clamp(g.position(code)*2-1, -1, 1)
+}
+
+// Trigger returns the position of a trigger axis from 0 when released to 1 when fully pressed
+func (g *Gamepad) Trigger(code uint16) float64 {
+	return clamp(g.position(code), 0, 1)
+}
+
+// position returns the position of the axis in its range, from 0 to 1
+func (g *Gamepad) position(code uint16) float64 {
+	v := g.axes[code]
+	info, ok := g.abs[code]
+	if !ok || info.Maximum <= info.Minimum {
+		info = AbsInfo{Minimum: -32768, Maximum: 32767}
+	}
+	return float64(v-info.Minimum) / float64(info.Maximum-info.Minimum)
+}
+
+func clamp(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -2,10 +2,11 @@ package gfx
 
 // Font4x6 4 x 6 raster font
 var Font4x6 = &Font{
-	W:         4,
-	H:         6,
-	FirstChar: 0,
-	LastChar:  255,
+	W:           4,
+	H:           6,
+	FirstChar:   0,
+	LastChar:    255,
+	DefaultChar: 255,
 	data: []byte{
 		/*
 		 * code=0, hex=0x00, ascii="^@"
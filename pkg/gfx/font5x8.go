@@ -2,10 +2,11 @@ package gfx
 
 // Font5x8 5 x 8 raster font
 var Font5x8 = &Font{
-	W:         5,
-	H:         8,
-	FirstChar: 0,
-	LastChar:  255,
+	W:           5,
+	H:           8,
+	FirstChar:   0,
+	LastChar:    255,
+	DefaultChar: 255,
 	data: []byte{
 
 		/*
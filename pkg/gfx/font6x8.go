@@ -2,10 +2,11 @@ package gfx
 
 // Font6x8 6 x 8 raster font
 var Font6x8 = &Font{
-	W:         6,
-	H:         8,
-	FirstChar: 0,
-	LastChar:  255,
+	W:           6,
+	H:           8,
+	FirstChar:   0,
+	LastChar:    255,
+	DefaultChar: 255,
 	data: []byte{
 		/*
 		 * code=0, hex=0x00, ascii="^@"
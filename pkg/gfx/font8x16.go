@@ -2,10 +2,11 @@ package gfx
 
 // Font8x16 8 x 16 raster font
 var Font8x16 = &Font{
-	W:         8,
-	H:         16,
-	FirstChar: 0,
-	LastChar:  255,
+	W:           8,
+	H:           16,
+	FirstChar:   0,
+	LastChar:    255,
+	DefaultChar: 255,
 	data: []byte{
 		// code=0, hex=0x00, ascii='^0'
 		0x00, /* 00000000 */
@@ -1,25 +1,36 @@
 package gfx
 
 import (
+	"fmt"
 	"math/rand"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	defaultTargetFrameRate = 60
+	defaultKeyRepeatDelay  = 0.5
+	defaultKeyRepeatRate   = 10
+	defaultFixedTimeStep   = 1.0 / 60.0
+
+	// maxFixedUpdateTime is the most simulation time run by the fixed updates of a frame. When the fixed updates
+	// take longer than the time they simulate, the time that is not caught up on is dropped rather than running
+	// ever more fixed updates per frame.
+	maxFixedUpdateTime = 0.25
 )
 
 var (
 	width  float64
 	height float64
-	scaleX float64
-	scaleY float64
 
-	fps             int
+	fps             int32
 	isFixed         bool
 	targetFrameRate int
 	targetFrameTime float64
+	fixedTimeStep   float64
 )
 
 // Application defines the interface that must be implemented by an application using the graphics interface.
@@ -34,47 +45,185 @@ type Application interface {
 	Unload()
 }
 
-// Font represents a raster font that can be used to render text
+// FixedApplication is an optional interface of an Application that advances its simulation in fixed time steps,
+// which keeps physics stable and deterministic regardless of the frame rate. Update is still called once per frame
+// before the fixed updates, and is the place to handle one shot input like KeyJustPressed.
+type FixedApplication interface {
+	Application
+
+	// FixedUpdate is called zero or more times per frame to advance the simulation by dt seconds, the step set by SetFixedTimeStep
+	FixedUpdate(dt float64)
+
+	// Draw is called once per frame after the fixed updates to render the frame. The alpha argument, from 0 to 1, is the
+	// fraction of a time step that has elapsed since the last fixed update, used to interpolate between the previous
+	// and the current state of the simulation.
+	Draw(alpha float64)
+}
+
+// CloseHandler is an optional interface of an Application that decides what happens when the user asks to close
+// the window. Without it the application quits.
+type CloseHandler interface {
+	// OnCloseRequested is called from the update loop when the user asks to close the window. Return true to quit,
+	// or false to keep running, for example to ask the user to save before calling Quit.
+	OnCloseRequested() bool
+}
+
+// Font represents a raster font that can be used to render text.
+// Fonts with a sparse glyph table, like loaded Unicode fonts, only use FirstChar and LastChar to describe
+// the glyphs they have in the byte range.
 type Font struct {
 	W, H                int
 	FirstChar, LastChar byte
-	data                []byte
+
+	// DefaultChar is rendered for characters that neither the font nor its fallback fonts have a glyph for. The
+	// built-in fonts render their last character, as they did before characters beyond the byte range were supported.
+	DefaultChar rune
+
+	// Fallback is searched for characters that the font does not have a glyph for
+	Fallback *Font
+
+	data    []byte
+	index   map[rune]int
+	metrics []GlyphMetrics
+	kerning map[kernPair]int
+}
+
+// Config describes the window and graphics device created by InitWithConfig
+type Config struct {
+	// Title is the title of the window
+	Title string
+
+	// X, Y are the position of the window on the screen, they are ignored when the window is centred
+	X, Y int
+
+	// Width, Height are the size of the graphics surface in pixels
+	Width, Height int
+
+	// ScaleX, ScaleY are the number of window pixels per surface pixel, a scale of 0 is treated as 1
+	ScaleX, ScaleY int
+
+	// Centered centres the window on the screen
+	Centered bool
+
+	// Fullscreen covers the screen with the window, the surface is presented according to the scale mode, see SetFullscreen
+	Fullscreen bool
+
+	// Resizable allows the user to resize the window
+	Resizable bool
+
+	// Borderless creates the window without a border and title bar
+	Borderless bool
+
+	// Hidden creates the window without showing it, call SetWindowVisible to show it once the application is ready
+	Hidden bool
+
+	// VSync paces the frames at the refresh rate of the display. Without it the frames run as fast as possible,
+	// unless the frame rate is fixed with EnableFixedFrameRate.
+	VSync bool
+
+	// Icon is the icon of the window, shown by the window manager in the title bar and task bar
+	Icon *Texture
+
+	// ScaleMode defines how the surface is presented when the size of the window changes, see SetScaleMode
+	ScaleMode ScaleMode
+
+	// Filter is the filter applied when the surface is scaled to the window, see SetPresentFilter
+	Filter PresentFilter
+
+	// FullPresent presents the whole surface every frame. By default only the parts of the surface drawn since the
+	// last frame are presented, FullPresent saves keeping track of them in applications that redraw everything.
+	FullPresent bool
+
+	// HighDPI multiplies the scale by the scale of the display, so that the window keeps its apparent size
+	// on displays with more than 96 pixels per inch
+	HighDPI bool
+
+	// NoSharedMemory stops the X driver from presenting the frames through shared memory when the X server runs on
+	// the same machine, the pixels are sent over the connection instead. The other drivers ignore it.
+	NoSharedMemory bool
 }
 
 // Init initialized the graphics system, creates the platform specific window and related graphics devices.
-func Init(title string, x, y, w, h, xscale, yscale int) bool {
+// The window is shown at x, y and presents the frames at the refresh rate of the display.
+func Init(title string, x, y, w, h, xscale, yscale int) error {
+	return InitWithConfig(Config{
+		Title:  title,
+		X:      x,
+		Y:      y,
+		Width:  w,
+		Height: h,
+		ScaleX: xscale,
+		ScaleY: yscale,
+		VSync:  true,
+	})
+}
+
+// InitWithConfig initializes the graphics system, creates the platform specific window described by cfg and related graphics devices.
+func InitWithConfig(cfg Config) error {
 	runtime.LockOSThread()
 
-	width = float64(w)
-	height = float64(h)
-	scaleX = float64(xscale)
-	scaleY = float64(yscale)
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return fmt.Errorf("gfx: invalid surface size %dx%d", cfg.Width, cfg.Height)
+	}
+	if cfg.ScaleX <= 0 {
+		cfg.ScaleX = 1
+	}
+	if cfg.ScaleY <= 0 {
+		cfg.ScaleY = 1
+	}
+
+	width = float64(cfg.Width)
+	height = float64(cfg.Height)
 
 	isFixed = false
 	SetTargetFrameRate(defaultTargetFrameRate)
+	SetFixedTimeStep(defaultFixedTimeStep)
 
 	iomgr = &ioManager{}
-	driver.Init()
+	iomgr.setKeyRepeat(defaultKeyRepeatDelay, defaultKeyRepeatRate)
+	iomgr.setViewport(scaledView(cfg.Width, cfg.Height, cfg.ScaleX, cfg.ScaleY), cfg.Width, cfg.Height)
+	if err := driver.Init(); err != nil {
+		return fmt.Errorf("gfx: init: %w", err)
+	}
 
-	if !driver.CreateWindow(x, y, w, h, xscale, yscale) {
-		return false
+	if err := driver.CreateWindow(cfg); err != nil {
+		return fmt.Errorf("gfx: create window: %w", err)
 	}
 
-	if !driver.CreateDevice() {
-		return false
+	if err := driver.CreateDevice(); err != nil {
+		return fmt.Errorf("gfx: create device: %w", err)
 	}
 
-	driver.SetWindowTitle(title)
+	driver.SetWindowTitle(cfg.Title)
 
-	return true
+	return nil
 }
 
-// Run starts the application running and executes the platform specific event loop. This function blocks.
-func Run(app Application) {
+// Run starts the application running and executes the platform specific event loop. This function blocks
+// until the application quits, and returns the error that ended it, like the connection to the display closing,
+// or the first error reported by the platform while the application was running.
+func Run(app Application) error {
 	app.Load()
-	go run(app)
-	driver.StartEventLoop()
+	atomic.StoreInt32(&running, 1)
+	done := make(chan struct{})
+	go func() {
+		run(app)
+		close(done)
+	}()
+	err := driver.StartEventLoop()
+	shutdown()
+	<-done
 	app.Unload()
+	if err == nil {
+		err = takeError()
+	}
+	return err
+}
+
+// Quit ends the application. The current update frame completes, after which Unload is called and Run returns.
+func Quit() {
+	shutdown()
+	driver.Quit()
 }
 
 // Width returns the pixel width of graphics surface. This is an unscaled value.
@@ -87,12 +236,13 @@ func Height() float64 {
 	return height
 }
 
-// Fps returns the number of update frames executed in the last second
+// Fps returns the number of update frames per second, based on the time of the last frame. See FrameTimeStats for more detailed statistics.
 func Fps() int {
-	return fps
+	return int(atomic.LoadInt32(&fps))
 }
 
-// EnableFixedFrameRate enable or disable fixed frame rate
+// EnableFixedFrameRate enable or disable fixed frame rate. When the fixed frame rate is disabled the frames run at the
+// rate the driver presents frames to the window. The update loop sleeps while it waits for the next frame.
 func EnableFixedFrameRate(state bool) {
 	isFixed = state
 }
@@ -108,6 +258,20 @@ func TargetFrameRate() int {
 	return targetFrameRate
 }
 
+// SetFixedTimeStep sets the time step in seconds passed to FixedUpdate of a FixedApplication. The default is 1/60 of a second.
+// A step that is not greater than 0 is ignored and keeps the current step.
+func SetFixedTimeStep(step float64) {
+	if step <= 0 {
+		return
+	}
+	fixedTimeStep = step
+}
+
+// FixedTimeStep gets the current fixed time step
+func FixedTimeStep() float64 {
+	return fixedTimeStep
+}
+
 // Clear clears the graphics surface using the specified color
 func Clear(c Color) {
 	driver.Clear(c)
@@ -123,18 +287,99 @@ func KeyPressed(key Key) bool {
 	return iomgr.keyPressed(key)
 }
 
-// KeyJustPressed returns true if the key was just pressed. This will not continue to return true if the key is held down.
+// KeyJustPressed returns true if the key was pressed since the last update frame. This will not continue to return true if the key is held down.
+// A key that is pressed and released between two update frames is also reported as just pressed, and the result
+// does not change when KeyJustPressed is called more than once during the same update frame.
 // KeyJustPressed can be used to check the state of the mouse buttons.
 // This can be used for one shot key presses, that require the key to be released and repressed for each interaction.
 func KeyJustPressed(key Key) bool {
 	return iomgr.keyJustPressed(key)
 }
 
-// MouseXY returns the coordinates of the mouse
+// KeyJustReleased returns true if the key was released since the last update frame.
+// KeyJustReleased can be used to check the state of the mouse buttons.
+func KeyJustReleased(key Key) bool {
+	return iomgr.keyJustReleased(key)
+}
+
+// KeyRepeated returns true in the update frame the key is pressed, and then repeatedly while the key is held
+// down, after the delay and at the rate set by SetKeyRepeat. This is useful for moving through menus.
+func KeyRepeated(key Key) bool {
+	return iomgr.keyRepeated(key)
+}
+
+// SetKeyRepeat sets the delay in seconds before a held key starts repeating, and the number of repeats per second
+// reported by KeyRepeated. A rate of 0 means no repeat, KeyRepeated only reports the initial press. A negative delay
+// or rate is ignored and keeps the current setting. The default is a delay of 0.5 seconds and 10 repeats per second.
+func SetKeyRepeat(delay, rate float64) {
+	iomgr.setKeyRepeat(delay, rate)
+}
+
+// KeyHeldTime returns the number of seconds the key has been held down, measured in update frame deltas.
+// KeyHeldTime returns 0 if the key is not pressed and in the update frame the key is pressed.
+func KeyHeldTime(key Key) float64 {
+	return iomgr.keyHeldTime(key)
+}
+
+// StartTextInput starts collecting the characters typed on the keyboard, which are returned by TextInput
+func StartTextInput() {
+	iomgr.setTextInput(true)
+}
+
+// StopTextInput stops collecting the characters typed on the keyboard
+func StopTextInput() {
+	iomgr.setTextInput(false)
+}
+
+// TextInput returns the characters typed since the last update frame while text input is active.
+// The characters reflect the keyboard layout, shift state and dead keys. Control keys like backspace
+// and return are not included and should be handled using KeyJustPressed. The returned slice is only
+// valid until the next update frame.
+func TextInput() []rune {
+	return iomgr.textInput()
+}
+
+// MouseXY returns the coordinates of the mouse in surface pixels, taking the scale mode into account.
+// The coordinates are outside the surface while the mouse is over the bars around it.
 func MouseXY() (float64, float64) {
 	return iomgr.mouseXY()
 }
 
+// MouseWheel returns the number of notches the mouse wheel was scrolled since the last update frame.
+// A positive dy scrolls up, away from the user, and a positive dx scrolls right.
+func MouseWheel() (dx, dy float64) {
+	return iomgr.mouseWheel()
+}
+
+// MouseDelta returns the distance the mouse moved since the last update frame. In relative mouse mode
+// the delta continues to report the motion of the mouse when the pointer would have reached the edge of the window.
+func MouseDelta() (dx, dy float64) {
+	return iomgr.mouseDelta()
+}
+
+// SetWindowVisible shows or hides the window, for example to show a window created with Config.Hidden
+func SetWindowVisible(visible bool) {
+	driver.SetWindowVisible(visible)
+}
+
+// SetFullscreen switches the window between fullscreen and windowed, for example when the player presses Alt+Enter.
+// A fullscreen window covers the monitor and presents the surface according to the scale mode. With the default
+// ScaleInteger mode the surface is shown at the largest integer scale that fits the monitor, centred with black bars around it.
+func SetFullscreen(fullscreen bool) {
+	driver.SetFullscreen(fullscreen)
+}
+
+// Fullscreen returns true if the window is fullscreen
+func Fullscreen() bool {
+	return driver.Fullscreen()
+}
+
+// SetRelativeMouseMode enables or disables relative mouse mode. In relative mouse mode the pointer is hidden
+// and confined to the window, and the motion of the mouse is reported by MouseDelta, as used for mouselook controls.
+func SetRelativeMouseMode(enabled bool) {
+	driver.SetRelativeMouseMode(enabled)
+}
+
 // Color represents a RGB color
 type Color uint32
 
@@ -201,6 +446,20 @@ func (c Color) Blend(o Color) Color {
 	return Rgba(r, g, b, na)
 }
 
+// Lerp linearly interpolates between the color and a second color. A t of 0 returns the color and a t of 1 returns o.
+func (c Color) Lerp(o Color, t float64) Color {
+	if t <= 0 {
+		return c
+	}
+	if t >= 1 {
+		return o
+	}
+	lerp := func(a, b int) int {
+		return a + int(float64(b-a)*t+0.5)
+	}
+	return Rgba(lerp(c.R(), o.R()), lerp(c.G(), o.G()), lerp(c.B(), o.B()), lerp(c.A(), o.A()))
+}
+
 // Predefined colors
 var (
 	Transparent     = Rgba(0, 0, 0, 0)
@@ -269,34 +528,160 @@ var (
 	C64LightGrey  = Rgb(179, 179, 179) // 15
 )
 
+// namedColors maps the lower case names of the predefined colors to their values
+var namedColors = map[string]Color{
+	"transparent":     Transparent,
+	"black":           Black,
+	"brightblue":      BrightBlue,
+	"brightgreen":     BrightGreen,
+	"brightcyan":      BrightCyan,
+	"brightred":       BrightRed,
+	"brightmagenta":   BrightMagenta,
+	"brightyellow":    BrightYellow,
+	"white":           White,
+	"blue":            Blue,
+	"green":           Green,
+	"cyan":            Cyan,
+	"red":             Red,
+	"magenta":         Magenta,
+	"yellow":          Yellow,
+	"grey":            Grey,
+	"darkblue":        DarkBlue,
+	"darkgreen":       DarkGreen,
+	"darkcyan":        DarkCyan,
+	"darkred":         DarkRed,
+	"darkmagenta":     DarkMagenta,
+	"darkyellow":      DarkYellow,
+	"darkgrey":        DarkGrey,
+	"verydarkblue":    VeryDarkBlue,
+	"verydarkgreen":   VeryDarkGreen,
+	"verydarkcyan":    VeryDarkCyan,
+	"verydarkred":     VeryDarkRed,
+	"verydarkmagenta": VeryDarkMagenta,
+	"verydarkyellow":  VeryDarkYellow,
+	"verydarkgrey":    VeryDarkGrey,
+	"zxblack":         ZXBlack,
+	"zxblue":          ZXBlue,
+	"zxred":           ZXRed,
+	"zxmagenta":       ZXMagenta,
+	"zxgreen":         ZXGreen,
+	"zxcyan":          ZXCyan,
+	"zxyellow":        ZXYellow,
+	"zxwhite":         ZXWhite,
+	"zxbrightblack":   ZXBrightBlack,
+	"zxbrightblue":    ZXBrightBlue,
+	"zxbrightred":     ZXBrightRed,
+	"zxbrightmagenta": ZXBrightMagenta,
+	"zxbrightgreen":   ZXBrightGreen,
+	"zxbrightcyan":    ZXBrightCyan,
+	"zxbrightyellow":  ZXBrightYellow,
+	"zxbrightwhite":   ZXBrightWhite,
+	"c64black":        C64Black,
+	"c64white":        C64White,
+	"c64red":          C64Red,
+	"c64cyan":         C64Cyan,
+	"c64purple":       C64Purple,
+	"c64green":        C64Green,
+	"c64blue":         C64Blue,
+	"c64yellow":       C64Yellow,
+	"c64orange":       C64Orange,
+	"c64brown":        C64Brown,
+	"c64lightred":     C64LightRed,
+	"c64darkgrey":     C64DarkGrey,
+	"c64grey":         C64Grey,
+	"c64lightgreen":   C64LightGreen,
+	"c64lightblue":    C64LightBlue,
+	"c64lightgrey":    C64LightGrey,
+}
+
+// ColorByName returns the predefined color with the specified name, ignoring case. For example "yellow" or "ZXBrightRed".
+// Colors can also be specified in hex notation as "#rrggbb" or "#aarrggbb".
+func ColorByName(name string) (Color, bool) {
+	if strings.HasPrefix(name, "#") && (len(name) == 7 || len(name) == 9) {
+		v, err := strconv.ParseUint(name[1:], 16, 32)
+		if err != nil {
+			return 0, false
+		}
+		if len(name) == 7 {
+			v |= 0xff000000
+		}
+		return Color(v), true
+	}
+	c, ok := namedColors[strings.ToLower(name)]
+	return c, ok
+}
+
 func run(app Application) {
-	running = true
-	lastUpdate := time.Now()
-	lastRender := time.Now()
-	frameTimer := 0.0
-
-	for running {
-		startUpdate := time.Now()
-		elapsedTime := startUpdate.Sub(lastUpdate).Seconds()
-		lastUpdate = startUpdate
-		frameTimer += elapsedTime
-
-		driver.Update(elapsedTime)
-		iomgr.update(elapsedTime)
-
-		if !isFixed || frameTimer >= targetFrameTime {
-			startRender := time.Now()
-			delta := startRender.Sub(lastRender).Seconds()
-			lastRender = startRender
-
-			app.Update(delta)
-			driver.Render(delta)
-			fps = (int)(1.0/delta + 0.5)
-			frameTimer -= targetFrameTime
+	var pacer framePacer
+	lastFrame := time.Now()
+	fixedApp, _ := app.(FixedApplication)
+	accumulator := 0.0
+
+	for atomic.LoadInt32(&running) != 0 {
+		// Frames are paced by the target frame rate when it is fixed, otherwise by the rate the driver presents frames
+		period := driver.PresentPeriod()
+		if isFixed {
+			period = targetFrameTime
+		}
+		pacer.wait(period)
+
+		startFrame := time.Now()
+		delta := startFrame.Sub(lastFrame).Seconds()
+		lastFrame = startFrame
+
+		driver.Update(delta)
+
+		var recorded []Event
+		if player != nil {
+			if frame, ok := player.next(); ok {
+				delta, recorded = frame.Delta, frame.Events
+			} else {
+				finishReplay()
+				if headless {
+					shutdown()
+					break
+				}
+			}
 		}
+		iomgr.update(delta, recorded)
+		if recorder != nil {
+			recorder.record(delta, iomgr.frame.events)
+		}
+
+		if iomgr.closeRequested() {
+			if h, ok := app.(CloseHandler); !ok || h.OnCloseRequested() {
+				Quit()
+				break
+			}
+		}
+
+		app.Update(delta)
+		if fixedApp != nil {
+			accumulator = runFixed(fixedApp, accumulator+delta)
+		}
+		driver.Render(delta)
+
+		stats.add(delta, time.Since(startFrame).Seconds())
+		if delta > 0 {
+			atomic.StoreInt32(&fps, int32(1.0/delta+0.5))
+		}
+	}
+}
+
+// runFixed runs the fixed updates for the time accumulated and draws the frame, returning the time left over
+func runFixed(app FixedApplication, accumulator float64) float64 {
+	if accumulator > maxFixedUpdateTime {
+		accumulator = maxFixedUpdateTime
+	}
+	step := fixedTimeStep
+	for accumulator >= step {
+		app.FixedUpdate(step)
+		accumulator -= step
 	}
+	app.Draw(accumulator / step)
+	return accumulator
 }
 
 func shutdown() {
-	running = false
+	atomic.StoreInt32(&running, 0)
 }
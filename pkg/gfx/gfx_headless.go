@@ -0,0 +1,137 @@
+//go:build headless
+// +build headless
+
+package gfx
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	driver = &headlessDriver{}
+	headless = true
+}
+
+// headlessDriver renders to a back buffer without a window, for automated tests that replay recorded input.
+// The application runs until the replay finishes.
+type headlessDriver struct {
+	width      int
+	height     int
+	backBuffer []Color
+	fullscreen bool
+}
+
+// Init initializes the platform driver
+func (e *headlessDriver) Init() error {
+	for i := range iomgr.keymap {
+		iomgr.setKeyMapping(byte(i), Key(i))
+	}
+	return nil
+}
+
+// CreateWindow sets the size of the back buffer, there is no window
+func (e *headlessDriver) CreateWindow(cfg Config) error {
+	e.width = cfg.Width
+	e.height = cfg.Height
+	return nil
+}
+
+// CreateDevice creates the back buffer
+func (e *headlessDriver) CreateDevice() error {
+	e.backBuffer = make([]Color, e.width*e.height)
+	return nil
+}
+
+// StartEventLoop waits for the application to end, there are no platform events
+func (e *headlessDriver) StartEventLoop() error {
+	for atomic.LoadInt32(&running) != 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+// Quit does nothing, the event loop ends when the application stops running
+func (e *headlessDriver) Quit() {
+}
+
+func (e *headlessDriver) Render(delta float64) {
+}
+
+// PresentPeriod returns 0, frames are not presented so they run as fast as possible
+func (e *headlessDriver) PresentPeriod() float64 {
+	return 0
+}
+
+func (e *headlessDriver) SetWindowTitle(title string) {
+}
+
+func (e *headlessDriver) SetWindowVisible(visible bool) {
+}
+
+func (e *headlessDriver) SetScaleMode(mode ScaleMode) {
+}
+
+func (e *headlessDriver) SetPresentFilter(filter PresentFilter) {
+}
+
+func (e *headlessDriver) SetFullscreen(fullscreen bool) {
+	e.fullscreen = fullscreen
+}
+
+func (e *headlessDriver) Fullscreen() bool {
+	return e.fullscreen
+}
+
+func (e *headlessDriver) SetRelativeMouseMode(enabled bool) {
+}
+
+func (e *headlessDriver) Update(delta float64) {
+}
+
+func (e *headlessDriver) Clear(c Color) {
+	for i := range e.backBuffer {
+		e.backBuffer[i] = c
+	}
+}
+
+func (e *headlessDriver) SetPixel(x, y int, c Color) {
+	if x < 0 || x >= e.width || y < 0 || y >= e.height {
+		return
+	}
+	p := &e.backBuffer[y*e.width+x]
+	if c.A() != 255 {
+		c = c.Blend(*p)
+	}
+	*p = c
+}
+
+func (e *headlessDriver) FillRect(x, y, w, h int, c Color) {
+	for py := y; py < y+h; py++ {
+		e.HLine(x, x+w-1, py, c)
+	}
+}
+
+func (e *headlessDriver) DrawTexture(x, y int, srcX, srcY, srcW, srcH int, t *Texture) {
+	for ty := 0; ty < srcH; ty++ {
+		for tx := 0; tx < srcW; tx++ {
+			sx, sy := srcX+tx, srcY+ty
+			if sx < 0 || sx >= t.W || sy < 0 || sy >= t.H {
+				continue
+			}
+			e.SetPixel(x+tx, y+ty, t.pixels[sy*t.W+sx])
+		}
+	}
+}
+
+func (e *headlessDriver) HLine(x1, x2, y int, c Color) {
+	for x := x1; x <= x2; x++ {
+		e.SetPixel(x, y, c)
+	}
+}
+
+func (e *headlessDriver) VLine(x, y1, y2 int, c Color) {
+	for y := y1; y <= y2; y++ {
+		e.SetPixel(x, y, c)
+	}
+}
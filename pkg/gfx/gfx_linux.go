@@ -1,21 +1,27 @@
-//go:build linux
-// +build linux
+//go:build linux && !headless
+// +build linux,!headless
 
 package gfx
 
 import (
-	"fmt"
+	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/jezek/xgb"
 	"github.com/jezek/xgb/bigreq"
+	"github.com/jezek/xgb/shm"
 	"github.com/jezek/xgb/xproto"
 )
 
+// presentCount marks the expose events sent by Render to present a frame, distinguishing
+// them from the expose events generated by the server
+const presentCount = 0xffff
+
 func init() {
 	driver = &xcbDriver{
-		renderPeriod: 1.0 / 60.0,
+		renderPeriod: defaultRefreshPeriod,
 	}
 }
 
@@ -32,102 +38,122 @@ type xcbDriver struct {
 	backBuffer   []byte
 	backBufPtr   unsafe.Pointer
 	renderBuffer []byte
+	renderW      int
+	renderH      int
 	scaleBuffer  []byte
 	putImageCmd  []byte
+	subImageCmd  []byte
+	presentW     int
+	presentH     int
+	scaler       presentScaler
+	filter       int32
+
+	// Only the rectangles of the back buffer drawn since the last present are copied, scaled and put in the window
+	dirty        dirtyRegion
+	renderRects  []rect
+	presentRects []rect
+	presentAll   bool
+
+	// The frames are presented from shared memory when the X server is local, the rendering flag is held
+	// until the server completed the put of the image, which is the request with the sequence number shmSeq
+	useSHM     bool
+	shmImage   *shmImage
+	shmPending bool
+	shmSeq     uint16
+
+	// presentStart is the time the frame being presented was started
+	presentStart time.Time
+
+	// Frames presented without shared memory are timed until the server sends the NoExposure event of the last
+	// CopyArea of the frame, the request with the sequence number copySeq. One frame is timed at a time.
+	lastCopySeq uint16
+	copyPending bool
+	copySeq     uint16
+	copyStart   time.Time
 
 	renderElapsed float64
 	renderPeriod  float64
 	rendering     int32
+
+	minKeycode xproto.Keycode
+	keysymsPer int
+	keysyms    []xproto.Keysym
+	deadKey    xproto.Keysym
+
+	relative    int32
+	blankCursor xproto.Cursor
+
+	gamepads *gamepadWatcher
+
+	wmProtocols    xproto.Atom
+	wmDeleteWindow xproto.Atom
+	windowW        int
+	windowH        int
+
+	netWMState           xproto.Atom
+	netWMStateFullscreen xproto.Atom
+	hints                [4]int
+	resizable            bool
+	visible              int32
+	fullscreen           int32
+
+	// The view is laid out by the event loop, the update loop resizes the back buffer when the size of
+	// the surface changes in ScaleResize mode
+	baseW      int
+	baseH      int
+	scaleMode  int32
+	layoutMode ScaleMode
+	viewMu     sync.Mutex
+	view       viewport
+	resize     surfaceResize
 }
 
 func (e *xcbDriver) Init() error {
 	var err error
 	e.conn, err = xgb.NewConn()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	bigreq.Init(e.conn)
 	bigreq.Enable(e.conn)
 
-	iomgr.setKeyMapping(0x09, KeyEsc)
-	iomgr.setKeyMapping(0x16, KeyBack)
-	iomgr.setKeyMapping(0x17, KeyTab)
-	iomgr.setKeyMapping(0x18, KeyQ)
-	iomgr.setKeyMapping(0x19, KeyW)
-	iomgr.setKeyMapping(0x1a, KeyE)
-	iomgr.setKeyMapping(0x1b, KeyR)
-	iomgr.setKeyMapping(0x1c, KeyT)
-	iomgr.setKeyMapping(0x1d, KeyY)
-	iomgr.setKeyMapping(0x1e, KeyU)
-	iomgr.setKeyMapping(0x1f, KeyI)
-	iomgr.setKeyMapping(0x20, KeyO)
-	iomgr.setKeyMapping(0x21, KeyP)
-	iomgr.setKeyMapping(0x24, KeyReturn)
-	iomgr.setKeyMapping(0x26, KeyA)
-	iomgr.setKeyMapping(0x27, KeyS)
-	iomgr.setKeyMapping(0x28, KeyD)
-	iomgr.setKeyMapping(0x29, KeyF)
-	iomgr.setKeyMapping(0x2a, KeyG)
-	iomgr.setKeyMapping(0x2b, KeyH)
-	iomgr.setKeyMapping(0x2c, KeyJ)
-	iomgr.setKeyMapping(0x2d, KeyK)
-	iomgr.setKeyMapping(0x2e, KeyL)
-
-	iomgr.setKeyMapping(0x34, KeyZ)
-	iomgr.setKeyMapping(0x35, KeyX)
-	iomgr.setKeyMapping(0x36, KeyC)
-	iomgr.setKeyMapping(0x37, KeyV)
-	iomgr.setKeyMapping(0x38, KeyB)
-	iomgr.setKeyMapping(0x39, KeyN)
-	iomgr.setKeyMapping(0x3a, KeyM)
-
-	iomgr.setKeyMapping(0x41, KeySpace)
-	iomgr.setKeyMapping(0x6e, KeyHome)
-	iomgr.setKeyMapping(0x6f, KeyUp)
-	iomgr.setKeyMapping(0x71, KeyLeft)
-	iomgr.setKeyMapping(0x72, KeyRight)
-	iomgr.setKeyMapping(0x73, KeyEnd)
-	iomgr.setKeyMapping(0x74, KeyDown)
-
-	iomgr.setKeyMapping(0x76, KeyInsert)
-	iomgr.setKeyMapping(0x77, KeyDelete)
-
-	iomgr.setKeyMapping(0x7f, KeyPause)
-
-	iomgr.setKeyMapping(0x5a, KeyNumPad0)
-	iomgr.setKeyMapping(0x57, KeyNumPad1)
-	iomgr.setKeyMapping(0x58, KeyNumPad2)
-	iomgr.setKeyMapping(0x59, KeyNumPad3)
-	iomgr.setKeyMapping(0x53, KeyNumPad4)
-	iomgr.setKeyMapping(0x54, KeyNumPad5)
-	iomgr.setKeyMapping(0x55, KeyNumPad6)
-	iomgr.setKeyMapping(0x4f, KeyNumPad7)
-	iomgr.setKeyMapping(0x50, KeyNumPad8)
-	iomgr.setKeyMapping(0x51, KeyNumPad9)
-
-	iomgr.setKeyMapping(0x3f, KeyMultiply)
-	iomgr.setKeyMapping(0x52, KeySubtract)
-	iomgr.setKeyMapping(0x56, KeyAdd)
-	iomgr.setKeyMapping(0x5b, KeyDecimal)
-	iomgr.setKeyMapping(0x6a, KeyDivide)
-
-	iomgr.setKeyMapping(0x43, KeyF1)
-	iomgr.setKeyMapping(0x44, KeyF2)
-	iomgr.setKeyMapping(0x45, KeyF3)
-	iomgr.setKeyMapping(0x46, KeyF4)
-	iomgr.setKeyMapping(0x47, KeyF5)
-	iomgr.setKeyMapping(0x48, KeyF6)
-	iomgr.setKeyMapping(0x49, KeyF7)
-	iomgr.setKeyMapping(0x4a, KeyF8)
-	iomgr.setKeyMapping(0x4b, KeyF9)
-	iomgr.setKeyMapping(0x4c, KeyF10)
-	iomgr.setKeyMapping(0x5f, KeyF11)
-	iomgr.setKeyMapping(0x60, KeyF12)
+	if err := e.loadKeyboardMapping(); err != nil {
+		e.conn.Close()
+		return err
+	}
 
 	return nil
 }
 
+// loadKeyboardMapping maps the keycodes of the X server to keys using the keysyms each keycode produces.
+// The first keysym of a keycode that has a key mapping is used, this maps the keypad to the numeric
+// keys rather than the navigation keys.
+func (e *xcbDriver) loadKeyboardMapping() error {
+	setup := xproto.Setup(e.conn)
+	count := int(setup.MaxKeycode) - int(setup.MinKeycode) + 1
+	reply, err := xproto.GetKeyboardMapping(e.conn, setup.MinKeycode, byte(count)).Reply()
+	if err != nil {
+		return err
+	}
+
+	per := int(reply.KeysymsPerKeycode)
+	e.minKeycode = setup.MinKeycode
+	e.keysymsPer = per
+	e.keysyms = reply.Keysyms
+	for i := 0; i < count; i++ {
+		key := Key(KeyUndefined)
+		for _, sym := range reply.Keysyms[i*per : (i+1)*per] {
+			if k, ok := keysymKeys[sym]; ok {
+				key = k
+				break
+			}
+		}
+		iomgr.setKeyMapping(byte(int(setup.MinKeycode)+i), key)
+	}
+	return nil
+}
+
 func (e *xcbDriver) idx(x, y int) int {
 	return (y*e.width + x) * 4
 }
@@ -137,6 +163,7 @@ func (e *xcbDriver) idxPtr(x, y int) unsafe.Pointer {
 }
 
 func (e *xcbDriver) Clear(c Color) {
+	e.dirty.markAll()
 	*(*Color)(unsafe.Pointer(e.backBufPtr)) = c
 
 	for i := 4; i < e.width*4*e.height; i *= 2 {
@@ -145,9 +172,10 @@ func (e *xcbDriver) Clear(c Color) {
 }
 
 func (e *xcbDriver) SetPixel(x, y int, c Color) {
-	if x < 0 || x > e.width || y < 0 || y > e.height {
+	if x < 0 || x >= e.width || y < 0 || y >= e.height {
 		return
 	}
+	e.dirty.markPixel(x, y)
 	ptr := e.idxPtr(x, y)
 	if c.A() != 255 {
 		c = c.Blend(*(*Color)(unsafe.Pointer(ptr)))
@@ -156,7 +184,7 @@ func (e *xcbDriver) SetPixel(x, y int, c Color) {
 }
 
 func (e *xcbDriver) FillRect(x, y, w, h int, c Color) {
-	if x > e.width || y > e.height || x+w < 0 || y+h < 0 {
+	if x >= e.width || y >= e.height || x+w < 0 || y+h < 0 {
 		return
 	}
 
@@ -174,6 +202,7 @@ func (e *xcbDriver) FillRect(x, y, w, h int, c Color) {
 	if y+h > e.height {
 		h -= (y + h) - e.height
 	}
+	e.dirty.mark(x, y, x+w, y+h)
 
 	ptr := e.idxPtr(x, y)
 	if c.A() != 255 {
@@ -195,7 +224,7 @@ func (e *xcbDriver) FillRect(x, y, w, h int, c Color) {
 }
 
 func (e *xcbDriver) DrawTexture(x, y, srcX, srcY, srcW, srcH int, t *Texture) {
-	if x > e.width || y > e.height || x+srcW < 0 || y+srcH < 0 || srcX >= t.W || srcY >= t.H {
+	if x >= e.width || y >= e.height || x+srcW < 0 || y+srcH < 0 || srcX >= t.W || srcY >= t.H {
 		return
 	}
 
@@ -252,6 +281,8 @@ func (e *xcbDriver) DrawTexture(x, y, srcX, srcY, srcW, srcH int, t *Texture) {
 		y2 -= (y + y2) - e.height
 	}
 
+	e.dirty.mark(x+x1, y+y1, x+x2, y+y2)
+
 	textureRowOffset := ((srcY+y1)*t.W + (srcX + x1)) * 4
 	bufferRowOffset := e.idx(x, y)
 
@@ -287,6 +318,7 @@ func (e *xcbDriver) HLine(x1, x2, y int, c Color) {
 	if x1 > x2 {
 		return
 	}
+	e.dirty.markSpan(y, x1, x2+1)
 
 	ptr := e.idxPtr(x1, y)
 	for i := 0; i <= x2-x1; i++ {
@@ -311,6 +343,7 @@ func (e *xcbDriver) VLine(x, y1, y2 int, c Color) {
 	if y1 > y2 {
 		return
 	}
+	e.dirty.mark(x, y1, x+1, y2+1)
 
 	ptr := e.idxPtr(x, y1)
 	for i := 0; i <= y2-y1; i++ {
@@ -322,16 +355,35 @@ func (e *xcbDriver) VLine(x, y1, y2 int, c Color) {
 	}
 }
 
-func (e *xcbDriver) CreateWindow(x, y, w, h, xscale, yscale int) bool {
+// CreateWindow creates the window described by cfg. The window manager is asked to honour the position,
+// size, decorations and state of the window with the standard hints.
+func (e *xcbDriver) CreateWindow(cfg Config) error {
 	var err error
 
 	e.wid, err = xproto.NewWindowId(e.conn)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	e.screen = xproto.Setup(e.conn).DefaultScreen(e.conn)
+	screenW, screenH := int(e.screen.WidthInPixels), int(e.screen.HeightInPixels)
+
+	w, h := cfg.Width, cfg.Height
+	sx, sy := cfg.ScaleX, cfg.ScaleY
+	if cfg.HighDPI && e.screen.WidthInMillimeters > 0 {
+		s := dpiScale(float64(screenW) * 25.4 / float64(e.screen.WidthInMillimeters))
+		sx, sy = sx*s, sy*s
+	}
+
+	// A fullscreen window is created at its windowed size, which the window manager restores when the
+	// window leaves fullscreen
+	x, y := cfg.X, cfg.Y
+	winW, winH := w*sx, h*sy
+	if cfg.Centered {
+		x, y = (screenW-winW)/2, (screenH-winH)/2
+	}
+
 	xproto.CreateWindow(e.conn, e.screen.RootDepth, e.wid, e.screen.Root,
-		int16(x), int16(y), uint16(w*xscale), uint16(h*yscale), 0,
+		int16(x), int16(y), uint16(winW), uint16(winH), 0,
 		xproto.WindowClassInputOutput, e.screen.RootVisual,
 		xproto.CwBackPixel|xproto.CwEventMask,
 		[]uint32{0xff000000,
@@ -342,70 +394,312 @@ func (e *xcbDriver) CreateWindow(x, y, w, h, xscale, yscale int) bool {
 				xproto.EventMaskKeyPress |
 				xproto.EventMaskKeyRelease |
 				xproto.EventMaskExposure |
-				xproto.EventMaskStructureNotify})
-	xproto.MapWindow(e.conn, e.wid)
+				xproto.EventMaskFocusChange})
+
+	// Ask the window manager to send a message when the window is closed instead of closing the connection
+	if e.wmProtocols, err = e.internAtom("WM_PROTOCOLS"); err != nil {
+		return err
+	}
+	if e.wmDeleteWindow, err = e.internAtom("WM_DELETE_WINDOW"); err != nil {
+		return err
+	}
+	xproto.ChangeProperty(e.conn, xproto.PropModeReplace, e.wid, e.wmProtocols, xproto.AtomAtom, 32, 1,
+		cardinals(uint32(e.wmDeleteWindow)))
+
+	if e.netWMState, err = e.internAtom("_NET_WM_STATE"); err != nil {
+		return err
+	}
+	if e.netWMStateFullscreen, err = e.internAtom("_NET_WM_STATE_FULLSCREEN"); err != nil {
+		return err
+	}
+
+	e.hints = [4]int{x, y, winW, winH}
+	e.resizable = cfg.Resizable
+	e.setSizeHints(cfg.Resizable || cfg.Fullscreen)
+	if cfg.Borderless {
+		if err := e.setBorderless(); err != nil {
+			return err
+		}
+	}
+	if cfg.Fullscreen {
+		e.fullscreen = 1
+		e.setFullscreenState(true)
+	}
+	if cfg.Icon != nil {
+		if err := e.setIcon(cfg.Icon); err != nil {
+			return err
+		}
+	}
+
+	e.useSHM = !cfg.NoSharedMemory && e.initSHM()
+
+	e.renderPeriod = 0
+	if cfg.VSync {
+		e.renderPeriod = e.refreshPeriod()
+	}
+
+	if !cfg.Hidden {
+		e.visible = 1
+		xproto.MapWindow(e.conn, e.wid)
+	}
+
+	view, sw, sh := layoutView(cfg.ScaleMode, winW, winH, w, h, sx, sy)
+	e.baseW = w
+	e.baseH = h
+	e.width = sw
+	e.height = sh
+	e.sx = sx
+	e.sy = sy
+	e.scaleMode = int32(cfg.ScaleMode)
+	e.filter = int32(cfg.Filter)
+	e.dirty.setFull(cfg.FullPresent)
+	e.layoutMode = cfg.ScaleMode
+	e.view = view
+	e.windowW = winW
+	e.windowH = winH
+	setSurfaceSize(sw, sh)
+	iomgr.setViewport(view, sw, sh)
+	return nil
+}
 
-	e.width = w
-	e.height = h
-	e.sx = xscale
-	e.sy = yscale
-	return true
+func (e *xcbDriver) internAtom(name string) (xproto.Atom, error) {
+	reply, err := xproto.InternAtom(e.conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0, err
+	}
+	return reply.Atom, nil
 }
 
-func (e *xcbDriver) CreateDevice() bool {
+func (e *xcbDriver) CreateDevice() error {
 	var err error
 	e.gid, err = xproto.NewGcontextId(e.conn)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	xproto.CreateGC(e.conn, e.gid,
 		xproto.Drawable(e.wid),
 		xproto.GcForeground,
 		[]uint32{e.screen.BlackPixel})
 
-	e.pid, err = xproto.NewPixmapId(e.conn)
-	if err != nil {
-		panic(err)
-	}
-	xproto.CreatePixmap(e.conn, e.screen.RootDepth, e.pid,
-		xproto.Drawable(e.wid), uint16(e.width*e.sx), uint16(e.height*e.sy))
-
 	bufSize := int(e.width * 4 * e.height)
 	e.backBuffer = make([]byte, bufSize)
 	e.backBufPtr = unsafe.Pointer(&e.backBuffer[0])
 	e.renderBuffer = make([]byte, bufSize)
+	e.renderW = e.width
+	e.renderH = e.height
+	e.dirty.reset(e.width, e.height)
+
+	return e.createPresentBuffers()
+}
+
+// createPresentBuffers creates the image that the render buffer is scaled into at the size of the view, in shared
+// memory when possible, otherwise in a put image request and the pixmap it is put in
+func (e *xcbDriver) createPresentBuffers() error {
+	e.presentW, e.presentH = e.view.w, e.view.h
+	bufSize := e.presentW * 4 * e.presentH
+
+	if e.shmImage != nil {
+		e.freeSHMImage(e.shmImage)
+		e.shmImage = nil
+	}
+	if e.useSHM {
+		img, err := e.newSHMImage(bufSize)
+		if err == nil {
+			e.shmImage = img
+			e.scaleBuffer = img.data
+			return nil
+		}
+		// Fall back to sending the image over the connection
+		e.useSHM = false
+	}
+
+	if e.pid != 0 {
+		xproto.FreePixmap(e.conn, e.pid)
+	}
+	pid, err := xproto.NewPixmapId(e.conn)
+	if err != nil {
+		return err
+	}
+	e.pid = pid
+	xproto.CreatePixmap(e.conn, e.screen.RootDepth, e.pid,
+		xproto.Drawable(e.wid), uint16(e.presentW), uint16(e.presentH))
 
-	bufSize = int((e.width * e.sx * 4) * (e.height * e.sy))
 	var imageOffset int
-	e.putImageCmd, imageOffset = putImageRequest(
+	e.putImageCmd, imageOffset = putImageRequest(nil,
 		xproto.ImageFormatZPixmap,
 		xproto.Drawable(e.pid),
 		e.gid,
-		uint16(e.width*e.sx), uint16(e.height*e.sy), 0, 0, 0,
+		uint16(e.presentW), uint16(e.presentH), 0, 0, 0,
 		e.screen.RootDepth, bufSize)
 	e.scaleBuffer = e.putImageCmd[imageOffset:]
 
-	return true
+	return nil
+}
+
+// layout places the surface in the window according to the scale mode. It is called by the event loop
+// when the window is resized or the scale mode changed.
+func (e *xcbDriver) layout() {
+	view, sw, sh := layoutView(e.layoutMode, e.windowW, e.windowH, e.baseW, e.baseH, e.sx, e.sy)
+	e.viewMu.Lock()
+	e.view = view
+	e.viewMu.Unlock()
+	if view.w != e.presentW || view.h != e.presentH {
+		reportError(e.createPresentBuffers())
+	}
+	e.resize.request(sw, sh)
+	iomgr.setViewport(view, sw, sh)
+
+	// Clear the bars around the view, the next frame presented fills the view
+	xproto.ClearArea(e.conn, false, e.wid, 0, 0, 0, 0)
+	e.presentAll = true
+}
+
+// SetScaleMode sets the scale mode, the event loop lays out the view again when it presents the next frame
+func (e *xcbDriver) SetScaleMode(mode ScaleMode) {
+	atomic.StoreInt32(&e.scaleMode, int32(mode))
+	e.dirty.markAll()
+}
+
+// SetPresentFilter sets the filter the event loop scales the next frames with
+func (e *xcbDriver) SetPresentFilter(filter PresentFilter) {
+	atomic.StoreInt32(&e.filter, int32(filter))
+	e.dirty.markAll()
+}
+
+func (e *xcbDriver) SetWindowVisible(visible bool) {
+	if visible {
+		atomic.StoreInt32(&e.visible, 1)
+		xproto.MapWindow(e.conn, e.wid)
+	} else {
+		atomic.StoreInt32(&e.visible, 0)
+		xproto.UnmapWindow(e.conn, e.wid)
+	}
 }
 
 func (e *xcbDriver) SetWindowTitle(title string) {
 	xproto.ChangeProperty(e.conn, xproto.PropModeReplace, e.wid, xproto.AtomWmName, xproto.AtomString, 8, uint32(len(title)), []byte(title))
 }
 
+// SetRelativeMouseMode grabs the pointer, confining it to the window with a blank cursor. The pointer is
+// warped back to the centre of the window after each motion event to measure the relative motion.
+func (e *xcbDriver) SetRelativeMouseMode(enabled bool) {
+	if !enabled {
+		atomic.StoreInt32(&e.relative, 0)
+		xproto.UngrabPointer(e.conn, xproto.TimeCurrentTime)
+		return
+	}
+
+	if e.blankCursor == 0 {
+		cursor, err := e.createBlankCursor()
+		if err != nil {
+			reportError(err)
+			return
+		}
+		e.blankCursor = cursor
+	}
+	_, err := xproto.GrabPointer(e.conn, true, e.wid,
+		xproto.EventMaskButtonPress|xproto.EventMaskButtonRelease|xproto.EventMaskPointerMotion,
+		xproto.GrabModeAsync, xproto.GrabModeAsync, e.wid, e.blankCursor, xproto.TimeCurrentTime).Reply()
+	if err != nil {
+		reportError(err)
+		return
+	}
+	cx, cy := e.centre()
+	xproto.WarpPointer(e.conn, 0, e.wid, 0, 0, 0, 0, int16(cx), int16(cy))
+	atomic.StoreInt32(&e.relative, 1)
+}
+
+// createBlankCursor creates a cursor with no visible pixels
+func (e *xcbDriver) createBlankCursor() (xproto.Cursor, error) {
+	pid, err := xproto.NewPixmapId(e.conn)
+	if err != nil {
+		return 0, err
+	}
+	xproto.CreatePixmap(e.conn, 1, pid, xproto.Drawable(e.screen.Root), 1, 1)
+	defer xproto.FreePixmap(e.conn, pid)
+
+	gid, err := xproto.NewGcontextId(e.conn)
+	if err != nil {
+		return 0, err
+	}
+	xproto.CreateGC(e.conn, gid, xproto.Drawable(pid), xproto.GcForeground, []uint32{0})
+	xproto.PolyFillRectangle(e.conn, xproto.Drawable(pid), gid, []xproto.Rectangle{{X: 0, Y: 0, Width: 1, Height: 1}})
+	xproto.FreeGC(e.conn, gid)
+
+	cid, err := xproto.NewCursorId(e.conn)
+	if err != nil {
+		return 0, err
+	}
+	xproto.CreateCursor(e.conn, cid, pid, pid, 0, 0, 0, 0, 0, 0, 0, 0)
+	return cid, nil
+}
+
+// centre returns the centre of the window in window pixels
+func (e *xcbDriver) centre() (int, int) {
+	e.viewMu.Lock()
+	defer e.viewMu.Unlock()
+	return e.view.x + e.view.w/2, e.view.y + e.view.h/2
+}
+
+// motion handles the motion of the pointer to x, y in window pixels
+func (e *xcbDriver) motion(x, y int) {
+	if atomic.LoadInt32(&e.relative) != 0 {
+		cx, cy := e.centre()
+		// Ignore the motion generated by warping the pointer back to the centre
+		if x == cx && y == cy {
+			return
+		}
+		iomgr.moveMouse(x-cx, y-cy)
+		xproto.WarpPointer(e.conn, 0, e.wid, 0, 0, 0, 0, int16(cx), int16(cy))
+		return
+	}
+	iomgr.updateMouse(x, y)
+}
+
+// Update resizes the back buffer when the size of the surface changed
 func (e *xcbDriver) Update(delta float64) {
+	if w, h, ok := e.resize.take(); ok && (w != e.width || h != e.height) {
+		e.width, e.height = w, h
+		e.backBuffer = make([]byte, w*h*4)
+		e.backBufPtr = unsafe.Pointer(&e.backBuffer[0])
+		e.dirty.reset(w, h)
+		setSurfaceSize(w, h)
+	}
+}
 
+// PresentPeriod returns the time between the frames presented to the window
+func (e *xcbDriver) PresentPeriod() float64 {
+	return e.renderPeriod
 }
 
 func (e *xcbDriver) Render(delta float64) {
 	e.renderElapsed += delta
 	if e.renderElapsed >= e.renderPeriod {
 		if atomic.CompareAndSwapInt32(&e.rendering, 0, 1) {
-			for e.renderElapsed >= e.renderPeriod {
+			for e.renderPeriod > 0 && e.renderElapsed >= e.renderPeriod {
 				e.renderElapsed -= e.renderPeriod
 			}
-			copy(e.renderBuffer, e.backBuffer)
+			if e.renderPeriod == 0 {
+				e.renderElapsed = 0
+			}
+			e.renderRects = e.dirty.take(e.renderRects[:0])
+			if len(e.renderRects) == 0 {
+				// Nothing was drawn since the last present
+				atomic.StoreInt32(&e.rendering, 0)
+				return
+			}
+			if len(e.renderBuffer) != len(e.backBuffer) {
+				e.renderBuffer = make([]byte, len(e.backBuffer))
+			}
+			stride := e.width * 4
+			for _, r := range e.renderRects {
+				for y := r.y0; y < r.y1; y++ {
+					copy(e.renderBuffer[y*stride+r.x0*4:y*stride+r.x1*4], e.backBuffer[y*stride+r.x0*4:y*stride+r.x1*4])
+				}
+			}
+			e.renderW, e.renderH = e.width, e.height
 			event := xproto.ExposeEvent{
-				Count:    1,
+				Count:    presentCount,
 				Sequence: 0,
 				Width:    uint16(e.width * e.sx),
 				Height:   uint16(e.height * e.sy),
@@ -418,27 +712,88 @@ func (e *xcbDriver) Render(delta float64) {
 	}
 }
 
-func (e *xcbDriver) StartEventLoop() {
+// StartEventLoop processes the X events until the window is destroyed. This function blocks.
+func (e *xcbDriver) StartEventLoop() error {
+	defer e.conn.Close()
+
+	// The gamepads are read while the event loop runs
+	e.gamepads = newGamepadWatcher()
+	e.gamepads.start()
+	defer e.gamepads.stop()
+
+	// next and nextErr are read ahead while looking for auto repeat, they are processed by the next iteration
+	var next xgb.Event
+	var nextErr xgb.Error
 	for {
-		ev, xerr := e.conn.WaitForEvent()
+		var ev xgb.Event
+		var xerr xgb.Error
+		if next != nil || nextErr != nil {
+			ev, xerr = next, nextErr
+			next, nextErr = nil, nil
+		} else {
+			ev, xerr = e.conn.WaitForEvent()
+		}
 		if ev == nil && xerr == nil {
-			break
+			if atomic.LoadInt32(&running) != 0 {
+				return ErrConnectionClosed
+			}
+			return nil
 		}
 		if xerr != nil {
-			fmt.Printf("Error: %v\n", xerr)
+			reportError(xerr)
+			// A failed put of the shared memory image is not completed, errors of other requests do not affect it
+			if e.copyPending && xerr.SequenceId() == e.copySeq {
+				e.copyPending = false
+			}
+			if e.shmPending && xerr.SequenceId() == e.shmSeq {
+				e.shmPending = false
+				atomic.StoreInt32(&e.rendering, 0)
+			}
 		}
 		if ev != nil {
 			switch evt := ev.(type) {
 			case xproto.NoExposureEvent:
-				continue
+				e.copied(evt.Sequence)
+			case xproto.GraphicsExposureEvent:
+				if evt.Count == 0 {
+					e.copied(evt.Sequence)
+				}
 			case xproto.ExposeEvent:
-				e.scaleImage()
-				xproto.CopyArea(e.conn, xproto.Drawable(e.pid),
-					xproto.Drawable(e.wid), xproto.Gcontext(e.gid),
-					0, 0, 0, 0, uint16(e.width*e.sx), uint16(e.height*e.sy))
-				atomic.StoreInt32(&e.rendering, 0)
+				// The render buffer is only read while the rendering flag is held. Render holds it for the frames
+				// it presents, server exposes take it unless a frame is already on its way, which then presents the
+				// whole view. The server exposes of a batch are handled once, with the last of them.
+				if evt.Count != presentCount {
+					if evt.Count != 0 {
+						continue
+					}
+					if !atomic.CompareAndSwapInt32(&e.rendering, 0, 1) {
+						e.presentAll = true
+						continue
+					}
+				}
+				if mode := ScaleMode(atomic.LoadInt32(&e.scaleMode)); mode != e.layoutMode {
+					e.layoutMode = mode
+					e.layout()
+				}
+				// Server exposes and new layouts need the whole view, frames only the rectangles drawn
+				all := e.presentAll || evt.Count != presentCount
+				e.presentAll = false
+				e.presentStart = time.Now()
+				e.present(all)
+				if !e.shmPending {
+					if !e.copyPending && len(e.presentRects) > 0 {
+						e.copyPending, e.copySeq, e.copyStart = true, e.lastCopySeq, e.presentStart
+					}
+					atomic.StoreInt32(&e.rendering, 0)
+				}
+			case shm.CompletionEvent:
+				if e.shmPending {
+					e.shmPending = false
+					presents.add(time.Since(e.presentStart).Seconds())
+					atomic.StoreInt32(&e.rendering, 0)
+				}
 			case xproto.MotionNotifyEvent:
-				iomgr.updateMouse(int(evt.EventX), int(evt.EventY))
+				e.motion(int(evt.EventX), int(evt.EventY))
 			case xproto.ButtonPressEvent:
 				switch evt.Detail {
 				case 1:
@@ -447,6 +802,18 @@ func (e *xcbDriver) StartEventLoop() {
 					iomgr.setKeyPressed(KeyMouseMiddle, true)
 				case 3:
 					iomgr.setKeyPressed(KeyMouseRight, true)
+				case 4:
+					iomgr.scrollWheel(0, 1)
+				case 5:
+					iomgr.scrollWheel(0, -1)
+				case 6:
+					iomgr.scrollWheel(-1, 0)
+				case 7:
+					iomgr.scrollWheel(1, 0)
+				case 8:
+					iomgr.setKeyPressed(KeyMouseBack, true)
+				case 9:
+					iomgr.setKeyPressed(KeyMouseForward, true)
 				}
 			case xproto.ButtonReleaseEvent:
 				switch evt.Detail {
@@ -456,43 +823,122 @@ func (e *xcbDriver) StartEventLoop() {
 					iomgr.setKeyPressed(KeyMouseMiddle, false)
 				case 3:
 					iomgr.setKeyPressed(KeyMouseRight, false)
+				case 8:
+					iomgr.setKeyPressed(KeyMouseBack, false)
+				case 9:
+					iomgr.setKeyPressed(KeyMouseForward, false)
 				}
 			case xproto.KeyPressEvent:
-				//fmt.Printf("Pressed: %0.2x\n", evt.Detail)
 				iomgr.setMappedKeyPressed(byte(evt.Detail), true)
+				e.typeKey(evt.Detail, evt.State)
 			case xproto.KeyReleaseEvent:
+				// Auto repeat is reported as a release immediately followed by a press of the key with the same time
+				nev, nerr := e.conn.PollForEvent()
+				nextErr = nerr
+				if nev != nil {
+					if press, ok := nev.(xproto.KeyPressEvent); ok && press.Detail == evt.Detail && press.Time == evt.Time {
+						iomgr.repeatMappedKey(byte(evt.Detail))
+						e.typeKey(press.Detail, press.State)
+						continue
+					}
+					next = nev
+				}
 				iomgr.setMappedKeyPressed(byte(evt.Detail), false)
-			default:
-				fmt.Printf("Event: %v\n", evt)
+			case xproto.FocusInEvent:
+				if evt.Mode != xproto.NotifyModeGrab && evt.Mode != xproto.NotifyModeUngrab {
+					iomgr.setFocus(true)
+				}
+			case xproto.FocusOutEvent:
+				if evt.Mode != xproto.NotifyModeGrab && evt.Mode != xproto.NotifyModeUngrab {
+					iomgr.setFocus(false)
+				}
+			case xproto.ConfigureNotifyEvent:
+				if int(evt.Width) != e.windowW || int(evt.Height) != e.windowH {
+					e.windowW, e.windowH = int(evt.Width), int(evt.Height)
+					iomgr.resize(e.windowW, e.windowH)
+					e.layout()
+				}
+			case xproto.ClientMessageEvent:
+				// The update loop decides whether to quit, which destroys the window
+				if evt.Type == e.wmProtocols && xproto.Atom(evt.Data.Data32[0]) == e.wmDeleteWindow {
+					iomgr.close()
+				}
+			case xproto.DestroyNotifyEvent:
+				if evt.Window == e.wid {
+					return nil
+				}
+			case xproto.MappingNotifyEvent:
+				if evt.Request == xproto.MappingKeyboard {
+					reportError(e.loadKeyboardMapping())
+				}
 			}
 		}
 	}
-	shutdown()
 }
 
-func (e *xcbDriver) scaleImage() {
-	if e.sx == 1 && e.sy == 1 {
-		copy(e.scaleBuffer, e.renderBuffer)
+// Quit destroys the window, which ends the event loop
+func (e *xcbDriver) Quit() {
+	xproto.DestroyWindow(e.conn, e.wid)
+}
+
+// present scales the rectangles of the render buffer drawn since the last present into the present image with the
+// present filter and puts them in the view, or the whole image when all is true
+func (e *xcbDriver) present(all bool) {
+	rects := e.renderRects
+	if all {
+		rects = append(rects[:0], rect{x1: e.renderW, y1: e.renderH})
+	}
+	e.presentRects = e.scaler.scaleRects(PresentFilter(atomic.LoadInt32(&e.filter)),
+		colors(e.scaleBuffer), e.presentW, e.presentH, colors(e.renderBuffer), e.renderW, e.renderH,
+		rects, e.presentRects[:0])
+
+	if e.shmImage != nil {
+		e.putSHMImage(e.presentRects)
+		return
+	}
+	full := rect{x1: e.presentW, y1: e.presentH}
+	for _, d := range e.presentRects {
+		e.putRect(d, d == full)
+	}
+}
+
+// copied records the time of the frame being timed when the server reports the CopyArea with sequence number seq
+// as done. The shared memory puts are timed by their completion event, so that both include the time the server
+// takes to read the pixels.
+func (e *xcbDriver) copied(seq uint16) {
+	if e.copyPending && seq == e.copySeq {
+		e.copyPending = false
+		presents.add(time.Since(e.copyStart).Seconds())
+	}
+}
+
+// putRect puts the rectangle d of the present image in the pixmap, and copies it to the view. The sequence number
+// of the copy is kept in lastCopySeq.
+func (e *xcbDriver) putRect(d rect, full bool) {
+	w, h := d.x1-d.x0, d.y1-d.y0
+	if full {
+		putImage(e.conn, e.putImageCmd)
 	} else {
-		dst := unsafe.Pointer(&e.scaleBuffer[0])
-		src := unsafe.Pointer(&e.renderBuffer[0])
-		cdst := 0
-		for y := 0; y < e.height; y++ {
-			for x := 0; x < e.width; x++ {
-				srcPixel := *(*uint32)(unsafe.Add(src, x*4))
-				for xi := 0; xi < e.sx; xi++ {
-					*(*uint32)(unsafe.Add(dst, (x*e.sx+xi)*4)) = srcPixel
-				}
-			}
-			row := cdst
-			for yi := 1; yi <= e.sy; yi++ {
-				cdst += e.width * e.sx * 4
-				copy(e.scaleBuffer[cdst:], e.scaleBuffer[row:row+(e.width*e.sx*4)])
-				row += e.width * e.sx * 4
-			}
-			dst = unsafe.Add(dst, e.width*e.sx*e.sy*4)
-			src = unsafe.Add(src, e.width*4)
+		var offset int
+		e.subImageCmd, offset = putImageRequest(e.subImageCmd,
+			xproto.ImageFormatZPixmap,
+			xproto.Drawable(e.pid),
+			e.gid,
+			uint16(w), uint16(h), int16(d.x0), int16(d.y0), 0,
+			e.screen.RootDepth, w*h*4)
+		stride := e.presentW * 4
+		for y := d.y0; y < d.y1; y++ {
+			offset += copy(e.subImageCmd[offset:], e.scaleBuffer[y*stride+d.x0*4:y*stride+d.x1*4])
 		}
+		putImage(e.conn, e.subImageCmd)
 	}
-	putImage(e.conn, e.putImageCmd)
+	c := xproto.CopyArea(e.conn, xproto.Drawable(e.pid),
+		xproto.Drawable(e.wid), xproto.Gcontext(e.gid),
+		int16(d.x0), int16(d.y0), int16(e.view.x+d.x0), int16(e.view.y+d.y0), uint16(w), uint16(h))
+	e.lastCopySeq = c.Sequence
+}
+
+// colors returns the pixels of a 32 bit image as colors, sharing the memory of the image
+func colors(b []byte) []Color {
+	return unsafe.Slice((*Color)(unsafe.Pointer(&b[0])), len(b)/4)
 }
@@ -0,0 +1,269 @@
+//go:build linux && !headless
+// +build linux,!headless
+
+package gfx
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/taylorza/go-gfx/pkg/gfx/evdev"
+)
+
+// gamepadScanPeriod is the time between the scans for connected gamepads
+const gamepadScanPeriod = time.Second
+
+// evdevButtons maps the buttons of the evdev gamepad layout to the standard layout. The face buttons
+// are mapped by position, as documented for the Linux gamepad API.
+var evdevButtons = []struct {
+	code   uint16
+	button GamepadButton
+}{
+	{evdev.BtnSouth, GamepadA},
+	{evdev.BtnEast, GamepadB},
+	{evdev.BtnWest, GamepadX},
+	{evdev.BtnNorth, GamepadY},
+	{evdev.BtnTL, GamepadLeftShoulder},
+	{evdev.BtnTR, GamepadRightShoulder},
+	{evdev.BtnSelect, GamepadBack},
+	{evdev.BtnStart, GamepadStart},
+	{evdev.BtnMode, GamepadGuide},
+	{evdev.BtnThumbL, GamepadLeftStick},
+	{evdev.BtnThumbR, GamepadRightStick},
+	{evdev.BtnDPadUp, GamepadDPadUp},
+	{evdev.BtnDPadDown, GamepadDPadDown},
+	{evdev.BtnDPadLeft, GamepadDPadLeft},
+	{evdev.BtnDPadRight, GamepadDPadRight},
+}
+
+// evdevSticks maps the stick axes, which are centred on the middle of their range whatever range the device reports
+var evdevSticks = []struct {
+	code uint16
+	axis GamepadAxis
+}{
+	{evdev.AbsX, GamepadLeftX},
+	{evdev.AbsY, GamepadLeftY},
+	{evdev.AbsRX, GamepadRightX},
+	{evdev.AbsRY, GamepadRightY},
+}
+
+// gamepadWatcher scans /dev/input for gamepads that are connected and reads the events of each gamepad,
+// until it is stopped
+type gamepadWatcher struct {
+	mu      sync.Mutex
+	open    map[string]*evdev.Device
+	ignored map[string]bool
+	stopped bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	// Device nodes that could not be opened are not retried until the directory or the node changes, the
+	// permissions of a node set by udev change its ctime
+	dirTime time.Time
+	failed  map[string]time.Time
+}
+
+func newGamepadWatcher() *gamepadWatcher {
+	return &gamepadWatcher{
+		open:    make(map[string]*evdev.Device),
+		ignored: make(map[string]bool),
+		failed:  make(map[string]time.Time),
+		done:    make(chan struct{}),
+	}
+}
+
+// start starts scanning for gamepads in the background
+func (w *gamepadWatcher) start() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		for {
+			w.scan()
+			select {
+			case <-w.done:
+				return
+			case <-time.After(gamepadScanPeriod):
+			}
+		}
+	}()
+}
+
+// stop stops scanning, closes the gamepads and waits for their readers to end
+func (w *gamepadWatcher) stop() {
+	w.mu.Lock()
+	if w.stopped {
+		w.mu.Unlock()
+		return
+	}
+	w.stopped = true
+	close(w.done)
+	for _, dev := range w.open {
+		dev.Close()
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+}
+
+func (w *gamepadWatcher) scan() {
+	var dirTime time.Time
+	if fi, err := os.Stat("/dev/input"); err == nil {
+		dirTime = fi.ModTime()
+	}
+	paths, _ := filepath.Glob("/dev/input/event*")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+	if !dirTime.Equal(w.dirTime) {
+		w.dirTime = dirTime
+		w.failed = make(map[string]time.Time)
+	}
+
+	// Forget the devices that are no longer present, the device node can be reused by a gamepad
+	ignored := make(map[string]bool)
+	for _, path := range paths {
+		if w.open[path] != nil {
+			continue
+		}
+		if w.ignored[path] {
+			ignored[path] = true
+			continue
+		}
+		changed := nodeChangeTime(path)
+		if t, ok := w.failed[path]; ok && t.Equal(changed) {
+			continue
+		}
+
+		dev, err := evdev.Open(path)
+		if err != nil {
+			// The device is not accessible, udev might still be setting the permissions
+			w.failed[path] = changed
+			continue
+		}
+		delete(w.failed, path)
+		if !dev.IsGamepad() {
+			dev.Close()
+			ignored[path] = true
+			continue
+		}
+
+		pad := iomgr.connectGamepad(dev.Name())
+		if pad < 0 {
+			dev.Close()
+			continue
+		}
+		w.open[path] = dev
+		w.wg.Add(1)
+		go w.read(path, pad, dev)
+	}
+	w.ignored = ignored
+}
+
+// nodeChangeTime returns the time the device node or its permissions last changed
+func nodeChangeTime(path string) time.Time {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return time.Time{}
+	}
+	return time.Unix(int64(st.Ctim.Sec), int64(st.Ctim.Nsec))
+}
+
+// read reads the events of a gamepad until it is disconnected or the watcher is stopped
+func (w *gamepadWatcher) read(path string, pad int, dev *evdev.Device) {
+	defer w.wg.Done()
+
+	m := newEvdevMapping(dev.AbsInfo())
+	g := evdev.NewGamepad(dev.AbsInfo())
+	m.publish(pad, g)
+
+	r := evdev.NewReader(dev)
+	for {
+		ev, err := r.ReadEvent()
+		if err != nil {
+			break
+		}
+		changed := g.Process(ev)
+		if g.NeedsSync() {
+			// Events were dropped, read the state of the device so that no button stays pressed
+			state, err := dev.State()
+			if err != nil {
+				break
+			}
+			g.Sync(state)
+			changed = true
+		}
+		if changed {
+			m.publish(pad, g)
+		}
+	}
+
+	dev.Close()
+	iomgr.disconnectGamepad(pad)
+	w.mu.Lock()
+	delete(w.open, path)
+	w.mu.Unlock()
+}
+
+// evdevMapping maps the state of an evdev gamepad to the standard layout
+type evdevMapping struct {
+	leftTrigger  uint16
+	rightTrigger uint16
+	analog       bool
+}
+
+func newEvdevMapping(abs map[uint16]evdev.AbsInfo) *evdevMapping {
+	m := &evdevMapping{leftTrigger: evdev.AbsZ, rightTrigger: evdev.AbsRZ}
+	_, hasZ := abs[evdev.AbsZ]
+	_, hasBrake := abs[evdev.AbsBrake]
+	switch {
+	case hasZ:
+		m.analog = true
+	case hasBrake:
+		m.leftTrigger, m.rightTrigger = evdev.AbsBrake, evdev.AbsGas
+		m.analog = true
+	}
+	return m
+}
+
+// publish posts the state of the gamepad, only the buttons and axes that changed generate events
+func (m *evdevMapping) publish(pad int, g *evdev.Gamepad) {
+	for _, eb := range evdevButtons {
+		b := eb.button
+		pressed := g.Button(eb.code)
+		// The d-pad is reported as a hat axis by most gamepads
+		switch b {
+		case GamepadDPadUp:
+			pressed = pressed || g.Stick(evdev.AbsHat0Y) < -0.5
+		case GamepadDPadDown:
+			pressed = pressed || g.Stick(evdev.AbsHat0Y) > 0.5
+		case GamepadDPadLeft:
+			pressed = pressed || g.Stick(evdev.AbsHat0X) < -0.5
+		case GamepadDPadRight:
+			pressed = pressed || g.Stick(evdev.AbsHat0X) > 0.5
+		}
+		iomgr.setGamepadButton(pad, b, pressed)
+	}
+
+	for _, s := range evdevSticks {
+		iomgr.setGamepadAxis(pad, s.axis, g.Stick(s.code))
+	}
+
+	// Gamepads without analog triggers report them as buttons
+	left, right := 0.0, 0.0
+	if m.analog {
+		left, right = g.Trigger(m.leftTrigger), g.Trigger(m.rightTrigger)
+	}
+	if g.Button(evdev.BtnTL2) {
+		left = 1
+	}
+	if g.Button(evdev.BtnTR2) {
+		right = 1
+	}
+	iomgr.setGamepadAxis(pad, GamepadLeftTrigger, left)
+	iomgr.setGamepadAxis(pad, GamepadRightTrigger, right)
+}
@@ -0,0 +1,233 @@
+//go:build linux && !headless
+// +build linux,!headless
+
+package gfx
+
+import (
+	"unicode"
+
+	"github.com/jezek/xgb/xproto"
+)
+
+// keysymKeys maps X keysyms to keys. The keyboard mapping of the X server is used to find the
+// keycode that produces each keysym, so the keys follow the keyboard layout.
+var keysymKeys = map[xproto.Keysym]Key{
+	0xff08: KeyBack,
+	0xff09: KeyTab,
+	0xff0b: KeyClear,
+	0xff0d: KeyReturn,
+	0xff13: KeyPause,
+	0xff14: KeySCROLL,
+	0xff1b: KeyEsc,
+	0xff50: KeyHome,
+	0xff51: KeyLeft,
+	0xff52: KeyUp,
+	0xff53: KeyRight,
+	0xff54: KeyDown,
+	0xff55: KeyPageUp,
+	0xff56: KeyPageDown,
+	0xff57: KeyEnd,
+	0xff61: KeyPrintScreen,
+	0xff63: KeyInsert,
+	0xff67: KeyMenu,
+	0xff7f: KeyNumLock,
+	0xffff: KeyDelete,
+
+	0xffe1: KeyLeftShift,
+	0xffe2: KeyRightShift,
+	0xffe3: KeyLeftControl,
+	0xffe4: KeyRightControl,
+	0xffe5: KeyCapsLock,
+	0xffe9: KeyLeftAlt,
+	0xffea: KeyRightAlt,
+	0xfe03: KeyRightAlt, // ISO_Level3_Shift (AltGr)
+	0xffeb: KeyLeftSuper,
+	0xffec: KeyRightSuper,
+
+	0xff8d: KeyReturn, // KP_Enter
+	0xffaa: KeyMultiply,
+	0xffab: KeyAdd,
+	0xffac: KeySeparator,
+	0xffad: KeySubtract,
+	0xffae: KeyDecimal,
+	0xffaf: KeyDivide,
+	0xffb0: KeyNumPad0,
+	0xffb1: KeyNumPad1,
+	0xffb2: KeyNumPad2,
+	0xffb3: KeyNumPad3,
+	0xffb4: KeyNumPad4,
+	0xffb5: KeyNumPad5,
+	0xffb6: KeyNumPad6,
+	0xffb7: KeyNumPad7,
+	0xffb8: KeyNumPad8,
+	0xffb9: KeyNumPad9,
+
+	0x0020: KeySpace,
+	0x0027: KeyApostrophe,
+	0x002c: KeyComma,
+	0x002d: KeyMinus,
+	0x002e: KeyPeriod,
+	0x002f: KeySlash,
+	0x003b: KeySemicolon,
+	0x003d: KeyEquals,
+	0x005b: KeyLeftBracket,
+	0x005c: KeyBackslash,
+	0x005d: KeyRightBracket,
+	0x0060: KeyGrave,
+}
+
+func init() {
+	// Digits and letters, letters are mapped for both lower and upper case keysyms
+	for i := 0; i < 10; i++ {
+		keysymKeys[xproto.Keysym('0'+i)] = Key(Key0 + i)
+	}
+	for i := 0; i < 26; i++ {
+		keysymKeys[xproto.Keysym('a'+i)] = Key(KeyA + i)
+		keysymKeys[xproto.Keysym('A'+i)] = Key(KeyA + i)
+	}
+	// F1 - F24
+	for i := 0; i < 24; i++ {
+		keysymKeys[xproto.Keysym(0xffbe+i)] = Key(KeyF1 + i)
+	}
+}
+
+// deadKeys maps the dead keysyms to the spacing accent they produce on their own and pairs of
+// base characters and the accented characters they compose to.
+var deadKeys = map[xproto.Keysym]struct {
+	accent rune
+	pairs  string
+}{
+	0xfe50: {'`', "aàeèiìoòuùAÀEÈIÌOÒUÙ"},
+	0xfe51: {'´', "aáeéiíoóuúyýcćnńsśzźAÁEÉIÍOÓUÚYÝCĆNŃSŚZŹ"},
+	0xfe52: {'^', "aâeêiîoôuûAÂEÊIÎOÔUÛ"},
+	0xfe53: {'~', "aãnñoõAÃNÑOÕ"},
+	0xfe57: {'¨', "aäeëiïoöuüyÿAÄEËIÏOÖUÜ"},
+	0xfe58: {'°', "aåAÅ"},
+	0xfe5b: {'¸', "cçCÇ"},
+}
+
+// composeDeadKey returns the characters produced by typing ch after a dead key. If the dead key
+// does not combine with ch the spacing accent is returned followed by ch.
+func composeDeadKey(dead xproto.Keysym, ch rune) []rune {
+	d := deadKeys[dead]
+	if ch == ' ' {
+		return []rune{d.accent}
+	}
+	pairs := []rune(d.pairs)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i] == ch {
+			return []rune{pairs[i+1]}
+		}
+	}
+	return []rune{d.accent, ch}
+}
+
+// keypadRunes maps the keypad keysyms to the characters they produce
+var keypadRunes = map[xproto.Keysym]rune{
+	0xff80: ' ',
+	0xffaa: '*',
+	0xffab: '+',
+	0xffac: ',',
+	0xffad: '-',
+	0xffae: '.',
+	0xffaf: '/',
+	0xffbd: '=',
+}
+
+// keysymRune returns the character produced by a keysym. Latin-1 and Unicode keysyms are supported.
+func keysymRune(sym xproto.Keysym) (rune, bool) {
+	switch {
+	case sym >= 0x20 && sym <= 0x7e, sym >= 0xa0 && sym <= 0xff:
+		return rune(sym), true
+	case sym >= 0x01000100 && sym <= 0x0110ffff:
+		return rune(sym - 0x01000000), true
+	case sym >= 0xffb0 && sym <= 0xffb9:
+		return rune('0' + sym - 0xffb0), true
+	}
+	ch, ok := keypadRunes[sym]
+	return ch, ok
+}
+
+func isKeypadKeysym(sym xproto.Keysym) bool {
+	return sym >= 0xff80 && sym <= 0xffbd
+}
+
+// caseKeysyms returns the lower and upper case keysyms of a Latin-1 letter keysym
+func caseKeysyms(sym xproto.Keysym) (lower, upper xproto.Keysym) {
+	if sym > 0xff {
+		return sym, sym
+	}
+	return xproto.Keysym(unicode.ToLower(rune(sym))), xproto.Keysym(unicode.ToUpper(rune(sym)))
+}
+
+// keycodeKeysym returns the keysym produced by a keycode for the modifier state of a key event,
+// following the rules of the X core protocol for the shift, caps lock and num lock modifiers.
+// The level three shift (AltGr) is assumed to be bound to the Mod5 modifier.
+func (e *xcbDriver) keycodeKeysym(code xproto.Keycode, state uint16) xproto.Keysym {
+	i := int(code) - int(e.minKeycode)
+	if i < 0 || (i+1)*e.keysymsPer > len(e.keysyms) {
+		return 0
+	}
+	syms := e.keysyms[i*e.keysymsPer : (i+1)*e.keysymsPer]
+	sym := func(n int) xproto.Keysym {
+		if n < len(syms) {
+			return syms[n]
+		}
+		return 0
+	}
+
+	base := 0
+	if state&xproto.KeyButMaskMod5 != 0 && sym(4) != 0 {
+		base = 4
+	}
+	lower, upper := sym(base), sym(base+1)
+	if upper == 0 {
+		lower, upper = caseKeysyms(lower)
+	}
+
+	shift := state&xproto.KeyButMaskShift != 0
+	if state&xproto.KeyButMaskMod2 != 0 && isKeypadKeysym(upper) {
+		if shift {
+			return lower
+		}
+		return upper
+	}
+	if state&xproto.KeyButMaskLock != 0 {
+		if l, u := caseKeysyms(lower); l != u {
+			shift = !shift
+		}
+	}
+	if shift {
+		return upper
+	}
+	return lower
+}
+
+// typeKey adds the characters produced by a key press to the text input
+func (e *xcbDriver) typeKey(code xproto.Keycode, state uint16) {
+	if state&(xproto.KeyButMaskControl|xproto.KeyButMaskMod1) != 0 {
+		return
+	}
+
+	sym := e.keycodeKeysym(code, state)
+	if _, ok := deadKeys[sym]; ok {
+		if e.deadKey != 0 {
+			iomgr.addText(deadKeys[e.deadKey].accent)
+		}
+		e.deadKey = sym
+		return
+	}
+
+	ch, ok := keysymRune(sym)
+	if !ok {
+		return
+	}
+	if e.deadKey != 0 {
+		for _, c := range composeDeadKey(e.deadKey, ch) {
+			iomgr.addText(c)
+		}
+		e.deadKey = 0
+		return
+	}
+	iomgr.addText(ch)
+}
@@ -0,0 +1,84 @@
+//go:build linux && !headless
+// +build linux,!headless
+
+package gfx
+
+import (
+	"os"
+	"strings"
+
+	"github.com/jezek/xgb/shm"
+	"github.com/jezek/xgb/xproto"
+)
+
+// shmImage is an image in a shared memory segment attached by the X server. Presenting it with the MIT-SHM
+// extension saves writing the pixels to the connection when the server runs on the same machine.
+type shmImage struct {
+	seg  shm.Seg
+	data []byte
+}
+
+// localDisplay returns true if the display is an X server on this machine, reached through a local socket
+func localDisplay() bool {
+	d := os.Getenv("DISPLAY")
+	return strings.HasPrefix(d, ":") || strings.HasPrefix(d, "unix:")
+}
+
+// initSHM returns true if the X server is local and supports the MIT-SHM extension
+func (e *xcbDriver) initSHM() bool {
+	if !localDisplay() {
+		return false
+	}
+	if err := shm.Init(e.conn); err != nil {
+		return false
+	}
+	_, err := shm.QueryVersion(e.conn).Reply()
+	return err == nil
+}
+
+// newSHMImage creates a shared memory segment of size bytes and attaches it to the X server
+func (e *xcbDriver) newSHMImage(size int) (*shmImage, error) {
+	id, data, err := shmCreate(size)
+	if err != nil {
+		return nil, err
+	}
+	// The segment is destroyed once both the process and the server detached from it
+	defer shmRemove(id)
+
+	seg, err := shm.NewSegId(e.conn)
+	if err != nil {
+		shmDetach(data)
+		return nil, err
+	}
+	if err := shm.AttachChecked(e.conn, seg, uint32(id), true).Check(); err != nil {
+		shmDetach(data)
+		return nil, err
+	}
+	return &shmImage{seg: seg, data: data}, nil
+}
+
+// freeSHMImage detaches the segment from the server and the process. The server processes the detach after the
+// requests that use the segment, so an image still being presented is not affected.
+func (e *xcbDriver) freeSHMImage(img *shmImage) {
+	shm.Detach(e.conn, img.seg)
+	shmDetach(img.data)
+}
+
+// putSHMImage presents the rectangles of the shared memory image in the view. The server sends a completion event
+// once it has read the last rectangle, until then the image must not be written.
+func (e *xcbDriver) putSHMImage(rects []rect) {
+	for i, d := range rects {
+		var sendEvent byte
+		if i == len(rects)-1 {
+			sendEvent = 1
+		}
+		c := shm.PutImage(e.conn, xproto.Drawable(e.wid), e.gid, uint16(e.presentW), uint16(e.presentH),
+			uint16(d.x0), uint16(d.y0), uint16(d.x1-d.x0), uint16(d.y1-d.y0),
+			int16(e.view.x+d.x0), int16(e.view.y+d.y0), e.screen.RootDepth, xproto.ImageFormatZPixmap,
+			sendEvent, e.shmImage.seg, 0)
+		if sendEvent != 0 {
+			e.shmPending = true
+			e.shmSeq = c.Sequence
+		}
+	}
+}
@@ -0,0 +1,54 @@
+//go:build linux && !headless && (amd64 || arm || arm64 || riscv64 || mips64 || mips64le || loong64)
+// +build linux
+// +build !headless
+// +build amd64 arm arm64 riscv64 mips64 mips64le loong64
+
+package gfx
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// System V IPC flags
+const (
+	ipcPrivate = 0
+	ipcCreat   = 01000
+	ipcRmid    = 0
+)
+
+// shmCreate creates a private System V shared memory segment of size bytes and attaches it to the process
+func shmCreate(size int) (id int, data []byte, err error) {
+	r, _, errno := syscall.Syscall(syscall.SYS_SHMGET, ipcPrivate, uintptr(size), ipcCreat|0600)
+	if errno != 0 {
+		return 0, nil, errno
+	}
+	id = int(r)
+
+	addr, _, errno := syscall.Syscall(syscall.SYS_SHMAT, uintptr(id), 0, 0)
+	if errno != 0 {
+		shmRemove(id)
+		return 0, nil, errno
+	}
+
+	// The segment is outside of the Go heap, the address is reinterpreted rather than converted to keep vet from
+	// flagging the conversion of a uintptr that is not a pointer into Go memory
+	p := *(*unsafe.Pointer)(unsafe.Pointer(&addr))
+	return id, unsafe.Slice((*byte)(p), size), nil
+}
+
+// shmRemove marks a shared memory segment to be destroyed once the last process detaches from it
+func shmRemove(id int) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_SHMCTL, uintptr(id), ipcRmid, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// shmDetach detaches a shared memory segment from the process
+func shmDetach(data []byte) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_SHMDT, uintptr(unsafe.Pointer(&data[0])), 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
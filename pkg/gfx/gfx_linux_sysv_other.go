@@ -0,0 +1,21 @@
+//go:build linux && !headless && !amd64 && !arm && !arm64 && !riscv64 && !mips64 && !mips64le && !loong64
+// +build linux,!headless,!amd64,!arm,!arm64,!riscv64,!mips64,!mips64le,!loong64
+
+package gfx
+
+import "errors"
+
+// errNoSHM is returned on architectures that multiplex the System V IPC calls, which are not supported
+var errNoSHM = errors.New("shared memory is not supported on this architecture")
+
+func shmCreate(size int) (id int, data []byte, err error) {
+	return 0, nil, errNoSHM
+}
+
+func shmRemove(id int) error {
+	return errNoSHM
+}
+
+func shmDetach(data []byte) error {
+	return errNoSHM
+}
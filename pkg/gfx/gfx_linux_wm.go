@@ -0,0 +1,149 @@
+//go:build linux && !headless
+// +build linux,!headless
+
+package gfx
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+
+	"github.com/jezek/xgb/randr"
+	"github.com/jezek/xgb/xproto"
+)
+
+// Flags of the WM_NORMAL_HINTS property
+const (
+	sizeHintUSPosition = 1 << 0
+	sizeHintPSize      = 1 << 3
+	sizeHintPMinSize   = 1 << 4
+	sizeHintPMaxSize   = 1 << 5
+)
+
+// motifDecorationsFlag marks the decorations field of the _MOTIF_WM_HINTS property as valid
+const motifDecorationsFlag = 1 << 1
+
+// cardinals encodes 32 bit values as the data of a property with format 32
+func cardinals(values ...uint32) []byte {
+	b := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(b[i*4:], v)
+	}
+	return b
+}
+
+// changeProperty replaces a property of the window with 32 bit values
+func (e *xcbDriver) changeProperty(property, typ xproto.Atom, values ...uint32) {
+	xproto.ChangeProperty(e.conn, xproto.PropModeReplace, e.wid, property, typ, 32, uint32(len(values)), cardinals(values...))
+}
+
+// Actions of the _NET_WM_STATE client message
+const (
+	netWMStateRemove = 0
+	netWMStateAdd    = 1
+)
+
+// netWMSourceApplication identifies a client message sent by an application rather than a pager
+const netWMSourceApplication = 1
+
+// setSizeHints sets the position and size of the window, and fixes the size unless the window is resizable
+func (e *xcbDriver) setSizeHints(resizable bool) {
+	x, y, w, h := e.hints[0], e.hints[1], e.hints[2], e.hints[3]
+	hints := make([]uint32, 18)
+	hints[0] = sizeHintUSPosition | sizeHintPSize
+	hints[1], hints[2], hints[3], hints[4] = uint32(x), uint32(y), uint32(w), uint32(h)
+	if !resizable {
+		hints[0] |= sizeHintPMinSize | sizeHintPMaxSize
+		hints[5], hints[6], hints[7], hints[8] = uint32(w), uint32(h), uint32(w), uint32(h)
+	}
+	e.changeProperty(xproto.AtomWmNormalHints, xproto.AtomWmSizeHints, hints...)
+}
+
+// setBorderless asks the window manager not to decorate the window
+func (e *xcbDriver) setBorderless() error {
+	hints, err := e.internAtom("_MOTIF_WM_HINTS")
+	if err != nil {
+		return err
+	}
+	e.changeProperty(hints, hints, motifDecorationsFlag, 0, 0, 0, 0)
+	return nil
+}
+
+// setFullscreenState sets the state the window manager shows the window in when it is mapped
+func (e *xcbDriver) setFullscreenState(fullscreen bool) {
+	if fullscreen {
+		e.changeProperty(e.netWMState, xproto.AtomAtom, uint32(e.netWMStateFullscreen))
+	} else {
+		xproto.DeleteProperty(e.conn, e.wid, e.netWMState)
+	}
+}
+
+// SetFullscreen asks the window manager to switch the window between fullscreen and windowed. The window
+// manager only changes the state of a mapped window on request, the state of a hidden window is set directly.
+// The resize of the window lays out the surface.
+func (e *xcbDriver) SetFullscreen(fullscreen bool) {
+	var state int32
+	if fullscreen {
+		state = 1
+	}
+	if atomic.SwapInt32(&e.fullscreen, state) == state {
+		return
+	}
+
+	// A window with a fixed size can not cover the screen
+	if fullscreen {
+		e.setSizeHints(true)
+	}
+	if atomic.LoadInt32(&e.visible) != 0 {
+		action := uint32(netWMStateRemove)
+		if fullscreen {
+			action = netWMStateAdd
+		}
+		ev := xproto.ClientMessageEvent{
+			Format: 32,
+			Window: e.wid,
+			Type:   e.netWMState,
+			Data: xproto.ClientMessageDataUnionData32New([]uint32{
+				action, uint32(e.netWMStateFullscreen), 0, netWMSourceApplication, 0}),
+		}
+		xproto.SendEvent(e.conn, false, e.screen.Root,
+			xproto.EventMaskSubstructureNotify|xproto.EventMaskSubstructureRedirect, string(ev.Bytes()))
+	} else {
+		e.setFullscreenState(fullscreen)
+	}
+	if !fullscreen {
+		e.setSizeHints(e.resizable)
+	}
+}
+
+// Fullscreen returns true if the window is fullscreen, or was asked to be
+func (e *xcbDriver) Fullscreen() bool {
+	return atomic.LoadInt32(&e.fullscreen) != 0
+}
+
+// setIcon sets the icon of the window, as the width and height followed by the ARGB pixels
+func (e *xcbDriver) setIcon(t *Texture) error {
+	icon, err := e.internAtom("_NET_WM_ICON")
+	if err != nil {
+		return err
+	}
+	values := make([]uint32, 2, 2+len(t.pixels))
+	values[0], values[1] = uint32(t.W), uint32(t.H)
+	for _, c := range t.pixels {
+		values = append(values, uint32(c))
+	}
+	e.changeProperty(icon, xproto.AtomCardinal, values...)
+	return nil
+}
+
+// refreshPeriod returns the time between the refreshes of the screen reported by the RandR extension,
+// or the default period when the extension is not available
+func (e *xcbDriver) refreshPeriod() float64 {
+	if err := randr.Init(e.conn); err != nil {
+		return defaultRefreshPeriod
+	}
+	reply, err := randr.GetScreenInfo(e.conn, e.screen.Root).Reply()
+	if err != nil || reply.Rate == 0 {
+		return defaultRefreshPeriod
+	}
+	return 1 / float64(reply.Rate)
+}
@@ -1,5 +1,5 @@
-//go:build linux
-// +build linux
+//go:build linux && !headless
+// +build linux,!headless
 
 package gfx
 
@@ -8,8 +8,8 @@ import (
 	"github.com/jezek/xgb/xproto"
 )
 
-// BigRequest extentions
-func putImageRequest(Format byte, Drawable xproto.Drawable, Gc xproto.Gcontext,
+// BigRequest extentions, buf is reused for the request when it is large enough
+func putImageRequest(buf []byte, Format byte, Drawable xproto.Drawable, Gc xproto.Gcontext,
 	Width, Height uint16,
 	DstX, DstY int16,
 	LeftPad byte,
@@ -17,7 +17,11 @@ func putImageRequest(Format byte, Drawable xproto.Drawable, Gc xproto.Gcontext,
 	imageByteCount int) (cmd []byte, imageOffset int) {
 
 	size := xgb.Pad(28 + xgb.Pad(imageByteCount))
-	buf := make([]byte, size)
+	if cap(buf) >= size {
+		buf = buf[:size]
+	} else {
+		buf = make([]byte, size)
+	}
 	b := 0
 
 	buf[b] = 72 // PutImage opcode
@@ -0,0 +1,52 @@
+package gfx
+
+import "testing"
+
+type fixedApp struct {
+	updates int
+	alpha   float64
+}
+
+func (a *fixedApp) Load()                  {}
+func (a *fixedApp) Update(d float64)       {}
+func (a *fixedApp) Unload()                {}
+func (a *fixedApp) FixedUpdate(dt float64) { a.updates++ }
+func (a *fixedApp) Draw(alpha float64)     { a.alpha = alpha }
+
+func TestSetFixedTimeStepIgnoresInvalidSteps(t *testing.T) {
+	defer SetFixedTimeStep(FixedTimeStep())
+	SetFixedTimeStep(0.125)
+	for _, step := range []float64{0, -0.125} {
+		SetFixedTimeStep(step)
+		if FixedTimeStep() != 0.125 {
+			t.Fatalf("step %v replaced the step with %v", step, FixedTimeStep())
+		}
+
+		// The fixed updates keep running with the previous step
+		app := &fixedApp{}
+		left := runFixed(app, 0.1875)
+		if app.updates != 1 || left != 0.0625 || app.alpha != 0.5 {
+			t.Errorf("step %v: %d updates, %v left and alpha %v", step, app.updates, left, app.alpha)
+		}
+	}
+}
+
+func TestLayoutViewScaleInteger(t *testing.T) {
+	tests := []struct {
+		winW, winH, w, h, sx, sy int
+		want                     viewport
+	}{
+		// Square pixels use any integer scale, not only multiples of the scale of the surface
+		{1920, 1080, 320, 240, 3, 3, viewport{x: 320, y: 60, w: 1280, h: 960}},
+		{640, 480, 320, 240, 3, 3, viewport{w: 640, h: 480}},
+		// Pixels with an aspect ratio keep it
+		{1920, 1080, 320, 200, 2, 1, viewport{y: 240, w: 1920, h: 600}},
+		{400, 300, 320, 200, 2, 1, viewport{x: 40, y: 50, w: 320, h: 200}},
+	}
+	for _, tt := range tests {
+		v, sw, sh := layoutView(ScaleInteger, tt.winW, tt.winH, tt.w, tt.h, tt.sx, tt.sy)
+		if v != tt.want || sw != tt.w || sh != tt.h {
+			t.Errorf("%dx%d at %dx%d in %dx%d = %+v, want %+v", tt.w, tt.h, tt.sx, tt.sy, tt.winW, tt.winH, v, tt.want)
+		}
+	}
+}
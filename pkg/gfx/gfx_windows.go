@@ -1,23 +1,43 @@
-//go:build windows
-// +build windows
+//go:build windows && !headless
+// +build windows,!headless
 
 package gfx
 
 import (
-	"reflect"
+	"errors"
+	"fmt"
 	"sync/atomic"
 	"syscall"
+	"time"
+	"unicode/utf16"
 	"unsafe"
 
 	"github.com/taylorza/w32"
 )
 
+const (
+	wheelDelta = 120
+
+	wmPresent      = w32.WM_USER + 0x100
+	wmRelativeMode = w32.WM_USER + 0x101
+	wmQuit         = w32.WM_USER + 0x102
+	wmScaleMode    = w32.WM_USER + 0x103
+	wmFullscreen   = w32.WM_USER + 0x104
+)
+
+var (
+	user32         = syscall.NewLazyDLL("user32.dll")
+	procShowCursor = user32.NewProc("ShowCursor")
+	procClipCursor = user32.NewProc("ClipCursor")
+
+	procSetProcessDPIAware = user32.NewProc("SetProcessDPIAware")
+)
+
 func init() {
 	windowClassName, _ := syscall.UTF16PtrFromString("GO-GRAFIX-WINDOW")
 	driver = &windowsDriver{
 		windowClassName: windowClassName,
-		dibPixels:       make([]Color, 0),
-		renderPeriod:    1.0 / 60.0,
+		renderPeriod:    defaultRefreshPeriod,
 	}
 }
 
@@ -30,8 +50,44 @@ type windowsDriver struct {
 	backBuffer      []Color
 	backBufferPtr   unsafe.Pointer
 	dibPixels       []Color
-	scaleX          float64
-	scaleY          float64
+	dibW            int
+	dibH            int
+	icon            w32.HICON
+
+	// The update loop copies the frames to the render buffer, the window thread copies them into a DIB section the
+	// size of the frame, or scales them into a DIB section the size of the view with a filter other than
+	// FilterNearest. The DIB section and device contexts are only used by the window thread.
+	filter        int32
+	presentFilter PresentFilter
+	renderBuffer  []Color
+	renderW       int
+	renderH       int
+	scaler        presentScaler
+
+	// Only the rectangles of the back buffer drawn since the last present are copied, scaled and drawn in the window
+	dirty        dirtyRegion
+	renderRects  []rect
+	presentRects []rect
+	presentAll   bool
+
+	// The view is laid out by the window thread, the update loop resizes the back buffer when the size of
+	// the surface changes in ScaleResize mode
+	baseW     int
+	baseH     int
+	sx        int
+	sy        int
+	scaleMode ScaleMode
+	clientW   int
+	clientH   int
+	view      viewport
+	resize    surfaceResize
+
+	// The style and placement of the window are restored when the window leaves fullscreen
+	fullscreen   int32
+	isFullscreen bool
+	style        uint
+	exStyle      uint
+	windowRect   w32.RECT
 
 	rendering     int32
 	renderPeriod  float64
@@ -39,6 +95,12 @@ type windowsDriver struct {
 
 	dib    w32.HBITMAP
 	olddib w32.HGDIOBJ
+
+	highSurrogate uint16
+
+	relative int32
+
+	gamepads *xinputPoller
 }
 
 // Init initializes the platform driver
@@ -47,14 +109,14 @@ func (e *windowsDriver) Init() error {
 	for i := range iomgr.keymap {
 		iomgr.setKeyMapping(byte(i), Key(i))
 	}
+	e.gamepads = newXInputPoller()
 
 	return nil
 }
 
 // CreateWindow creates a window used to render the graphics.
-func (e *windowsDriver) CreateWindow(x, y, w, h, xscale, yscale int) bool {
-	e.width = w
-	e.height = h
+func (e *windowsDriver) CreateWindow(cfg Config) error {
+	w, h := cfg.Width, cfg.Height
 	hInst := w32.GetModuleHandle("")
 
 	wcex := &w32.WNDCLASSEX{
@@ -67,60 +129,161 @@ func (e *windowsDriver) CreateWindow(x, y, w, h, xscale, yscale int) bool {
 		Cursor:     w32.LoadCursor(0, w32.MakeIntResource(w32.IDC_ARROW)),
 		MenuName:   nil,
 		ClassName:  e.windowClassName,
-		Background: w32.HBRUSH(w32.COLOR_WINDOW + 1),
+		Background: w32.HBRUSH(w32.GetStockObject(w32.BLACK_BRUSH)),
 		WndProc:    syscall.NewCallback(e.wndProc),
 	}
 
 	wc := w32.RegisterClassEx(wcex)
 	if wc == 0 {
-		panic("Failed to register window class")
+		return lastError("register window class")
+	}
+
+	// A DPI aware process is not scaled by the system, the scale of the display is applied to the window scale instead
+	sx, sy := cfg.ScaleX, cfg.ScaleY
+	if cfg.HighDPI {
+		procSetProcessDPIAware.Call()
+		s := dpiScale(float64(screenCaps(w32.LOGPIXELSX)))
+		sx, sy = sx*s, sy*s
+	}
+	if refresh := screenCaps(w32.VREFRESH); refresh > 1 {
+		e.renderPeriod = 1 / float64(refresh)
+	}
+	if !cfg.VSync {
+		e.renderPeriod = 0
 	}
 
 	exStyle := uint(w32.WS_EX_APPWINDOW | w32.WS_EX_WINDOWEDGE)
 	style := uint(w32.WS_CAPTION | w32.WS_SYSMENU | w32.WS_BORDER)
+	switch {
+	case cfg.Borderless:
+		exStyle = w32.WS_EX_APPWINDOW
+		style = w32.WS_POPUP
+	case cfg.Resizable:
+		style |= w32.WS_THICKFRAME | w32.WS_MAXIMIZEBOX
+	}
 
-	rc := w32.RECT{Left: 0, Top: 0, Right: int32(w * xscale), Bottom: int32(h * yscale)}
+	rc := w32.RECT{Left: 0, Top: 0, Right: int32(w * sx), Bottom: int32(h * sy)}
 	w32.AdjustWindowRectEx(&rc, style, false, exStyle)
 
+	x, y := cfg.X, cfg.Y
+	winW, winH := int(rc.Right-rc.Left), int(rc.Bottom-rc.Top)
+	screenW, screenH := w32.GetSystemMetrics(w32.SM_CXSCREEN), w32.GetSystemMetrics(w32.SM_CYSCREEN)
+	if cfg.Centered {
+		x, y = (screenW-winW)/2, (screenH-winH)/2
+	}
+	e.style, e.exStyle = style, exStyle
+	e.windowRect = w32.RECT{Left: int32(x), Top: int32(y), Right: int32(x + winW), Bottom: int32(y + winH)}
+	if cfg.Fullscreen {
+		style, exStyle = w32.WS_POPUP, w32.WS_EX_APPWINDOW
+		x, y, winW, winH = 0, 0, screenW, screenH
+		e.fullscreen = 1
+		e.isFullscreen = true
+	}
+
+	// The window is laid out when it is created, the surface starts at the size of the layout
+	e.baseW, e.baseH = w, h
+	e.sx, e.sy = sx, sy
+	e.scaleMode = cfg.ScaleMode
+	e.filter = int32(cfg.Filter)
+	e.dirty.setFull(cfg.FullPresent)
+	clientW, clientH := w*sx, h*sy
+	if cfg.Fullscreen {
+		clientW, clientH = screenW, screenH
+	}
+	_, e.width, e.height = layoutView(cfg.ScaleMode, clientW, clientH, w, h, sx, sy)
+	setSurfaceSize(e.width, e.height)
+
 	windowName, _ := syscall.UTF16PtrFromString("")
 	e.hMainWnd = w32.CreateWindowEx(
 		exStyle,
 		e.windowClassName,
 		windowName,
 		style,
-		x, y, int(rc.Right-rc.Left), int(rc.Bottom-rc.Top),
+		x, y, winW, winH,
 		w32.HWND(0),
 		w32.HMENU(0),
 		hInst,
 		unsafe.Pointer(nil))
 	if e.hMainWnd == 0 {
-		panic("Failed to create window")
+		return lastError("create window")
+	}
+
+	if cfg.Icon != nil {
+		if err := e.setIcon(cfg.Icon); err != nil {
+			return err
+		}
+	}
+
+	if !cfg.Hidden {
+		w32.ShowWindow(e.hMainWnd, w32.SW_SHOWDEFAULT)
+		w32.UpdateWindow(e.hMainWnd)
 	}
 
-	w32.ShowWindow(e.hMainWnd, w32.SW_SHOWDEFAULT)
-	w32.UpdateWindow(e.hMainWnd)
+	return nil
+}
+
+// screenCaps returns a device capability of the screen
+func screenCaps(index int) int {
+	hdc := w32.GetDC(0)
+	defer w32.ReleaseDC(0, hdc)
+	return w32.GetDeviceCaps(hdc, index)
+}
+
+// setIcon sets the large and small icon of the window to the texture
+func (e *windowsDriver) setIcon(t *Texture) error {
+	// The colors are stored as BGRA, which matches the memory layout of the ARGB colors, the mask is
+	// not used for icons with an alpha channel but must be present with its rows aligned to 16 bits
+	mask := make([]byte, ((t.W+15)/16)*2*t.H)
+	pixels := make([]byte, 4*len(t.pixels))
+	for i, c := range t.pixels {
+		pixels[i*4], pixels[i*4+1], pixels[i*4+2], pixels[i*4+3] = byte(c), byte(c>>8), byte(c>>16), byte(c>>24)
+	}
+	icon := w32.CreateIcon(w32.GetModuleHandle(""), t.W, t.H, 1, 32, &mask[0], &pixels[0])
+	if icon == 0 {
+		return lastError("create icon")
+	}
+	w32.SendMessage(e.hMainWnd, w32.WM_SETICON, w32.ICON_BIG, uintptr(icon))
+	w32.SendMessage(e.hMainWnd, w32.WM_SETICON, w32.ICON_SMALL, uintptr(icon))
+	e.icon = icon
+	return nil
+}
 
-	return true
+// lastError returns the last error of the calling thread, reported by a failed call to op
+func lastError(op string) error {
+	return fmt.Errorf("%s: %w", op, syscall.Errno(w32.GetLastError()))
 }
 
 // CreateDevice creates the platform specific graphics objects.
-func (e *windowsDriver) CreateDevice() bool {
+func (e *windowsDriver) CreateDevice() error {
 	hdc := w32.GetDC(e.hMainWnd)
 	if hdc == 0 {
-		return false
+		return errors.New("get device context failed")
 	}
 	defer w32.ReleaseDC(e.hMainWnd, hdc)
 
 	e.surfaceDC = w32.CreateCompatibleDC(hdc)
 	if e.surfaceDC == 0 {
-		return false
+		return errors.New("create compatible device context failed")
+	}
+
+	if err := e.createDIB(e.width, e.height); err != nil {
+		return err
 	}
 
+	e.backBuffer = make([]Color, e.width*e.height)
+	e.backBufferPtr = unsafe.Pointer(&e.backBuffer[0])
+	e.dirty.reset(e.width, e.height)
+
+	return nil
+}
+
+// createDIB creates the DIB section the back buffer is copied to for presenting, replacing the previous DIB section
+func (e *windowsDriver) createDIB(w, h int) error {
 	pbmi := &w32.BITMAPINFO{
 		BmiHeader: w32.BITMAPINFOHEADER{
 			BiSize:          uint32(unsafe.Sizeof(w32.BITMAPINFOHEADER{})),
-			BiWidth:         int32(e.width),
-			BiHeight:        int32(-e.height),
+			BiWidth:         int32(w),
+			BiHeight:        int32(-h),
 			BiPlanes:        1,
 			BiBitCount:      32,
 			BiCompression:   w32.BI_RGB,
@@ -133,30 +296,30 @@ func (e *windowsDriver) CreateDevice() bool {
 	}
 
 	var pbits unsafe.Pointer
-	e.dib = w32.CreateDIBSection(e.surfaceDC, pbmi, w32.DIB_RGB_COLORS, &pbits, 0, 0)
-	if e.dib == 0 {
-		return false
+	dib := w32.CreateDIBSection(e.surfaceDC, pbmi, w32.DIB_RGB_COLORS, &pbits, 0, 0)
+	if dib == 0 {
+		return errors.New("create DIB section failed")
 	}
 
-	var bmp w32.BITMAP
-	w32.GetObject(w32.HGDIOBJ(e.dib), unsafe.Sizeof(w32.BITMAP{}), unsafe.Pointer(&bmp))
-	bytes := bmp.BmWidth * bmp.BmHeight
-
-	e.backBuffer = make([]Color, bytes)
-	e.backBufferPtr = unsafe.Pointer(&e.backBuffer[0])
-
 	// Point the slice e.dibPixels over the pbits returned by CreateDIBSection
-	sh := (*reflect.SliceHeader)(unsafe.Pointer(&e.dibPixels))
-	sh.Len = int(bytes)
-	sh.Cap = int(bytes)
-	sh.Data = uintptr(pbits)
+	e.dibPixels = unsafe.Slice((*Color)(pbits), w*h)
 
-	e.olddib = w32.SelectObject(e.surfaceDC, w32.HGDIOBJ(e.dib))
+	old := w32.SelectObject(e.surfaceDC, w32.HGDIOBJ(dib))
+	if e.dib != 0 {
+		w32.DeleteObject(w32.HGDIOBJ(e.dib))
+	} else {
+		e.olddib = old
+	}
+	e.dib = dib
+	e.dibW, e.dibH = w, h
 
-	return true
+	return nil
 }
 
 func (e *windowsDriver) cleanup() {
+	if e.icon != 0 {
+		w32.DestroyIcon(e.icon)
+	}
 	if e.olddib != 0 && e.surfaceDC != 0 {
 		w32.SelectObject(e.surfaceDC, e.olddib)
 		w32.DeleteDC(e.surfaceDC)
@@ -165,13 +328,34 @@ func (e *windowsDriver) cleanup() {
 }
 
 // StartEventLoop runs the platform specific event loop. This function blocks.
-func (e *windowsDriver) StartEventLoop() {
+func (e *windowsDriver) StartEventLoop() error {
 	var msg w32.MSG
 	for w32.GetMessage(&msg, 0, 0, 0) {
 		w32.TranslateMessage(&msg)
 		w32.DispatchMessage(&msg)
 	}
 	e.cleanup()
+	return nil
+}
+
+// Quit asks the window thread to destroy the window, which ends the event loop
+func (e *windowsDriver) Quit() {
+	w32.PostMessage(e.hMainWnd, wmQuit, 0, 0)
+}
+
+// SetPresentFilter sets the filter the next frames are presented with
+func (e *windowsDriver) SetPresentFilter(filter PresentFilter) {
+	atomic.StoreInt32(&e.filter, int32(filter))
+	e.dirty.markAll()
+}
+
+// SetWindowVisible shows or hides the window
+func (e *windowsDriver) SetWindowVisible(visible bool) {
+	if visible {
+		w32.ShowWindow(e.hMainWnd, w32.SW_SHOW)
+	} else {
+		w32.ShowWindow(e.hMainWnd, w32.SW_HIDE)
+	}
 }
 
 // SetWindowTitle sets the title of the window
@@ -180,8 +364,21 @@ func (e *windowsDriver) SetWindowTitle(title string) {
 }
 
 // Update perform any platform specific updates.
+// Update polls the gamepads and resizes the back buffer when the size of the surface changed
 func (e *windowsDriver) Update(delta float64) {
+	e.gamepads.poll(delta)
+	if w, h, ok := e.resize.take(); ok && (w != e.width || h != e.height) {
+		e.width, e.height = w, h
+		e.backBuffer = make([]Color, w*h)
+		e.backBufferPtr = unsafe.Pointer(&e.backBuffer[0])
+		e.dirty.reset(w, h)
+		setSurfaceSize(w, h)
+	}
+}
 
+// PresentPeriod returns the time between the frames presented to the window
+func (e *windowsDriver) PresentPeriod() float64 {
+	return e.renderPeriod
 }
 
 // Render renders the back buffer to the window.
@@ -190,9 +387,82 @@ func (e *windowsDriver) Render(delta float64) {
 
 	if e.renderElapsed >= e.renderPeriod {
 		if atomic.CompareAndSwapInt32(&e.rendering, 0, 1) {
-			copy(e.dibPixels, e.backBuffer)
-			w32.PostMessage(e.hMainWnd, w32.WM_USER+0x100, 0, 0)
 			e.renderElapsed -= e.renderPeriod
+			e.renderRects = e.dirty.take(e.renderRects[:0])
+			filter := PresentFilter(atomic.LoadInt32(&e.filter))
+			if filter != e.presentFilter {
+				// The frames of the other filter were copied to the other buffer
+				e.presentFilter = filter
+				e.renderRects = append(e.renderRects[:0], rect{x1: e.width, y1: e.height})
+			}
+			if len(e.renderRects) == 0 {
+				// Nothing was drawn since the last present
+				atomic.StoreInt32(&e.rendering, 0)
+				return
+			}
+
+			if len(e.renderBuffer) != len(e.backBuffer) {
+				e.renderBuffer = make([]Color, len(e.backBuffer))
+			}
+			copyRects(e.renderBuffer, e.backBuffer, e.width, e.renderRects)
+			e.renderW, e.renderH = e.width, e.height
+			w32.PostMessage(e.hMainWnd, wmPresent, 0, 0)
+		}
+	}
+}
+
+// present draws the rectangles of the frame drawn since the last present in the view, or the whole frame when all
+// is true. Frames presented with a filter are scaled into a DIB section at the size of the view first.
+func (e *windowsDriver) present(all bool) {
+	v := e.view
+	rects := e.renderRects
+	if all {
+		rects = append(rects[:0], rect{x1: e.renderW, y1: e.renderH})
+	}
+	hdc := w32.GetDC(e.hMainWnd)
+	defer w32.ReleaseDC(e.hMainWnd, hdc)
+
+	if e.presentFilter == FilterNearest {
+		if e.dibW != e.renderW || e.dibH != e.renderH {
+			if err := e.createDIB(e.renderW, e.renderH); err != nil {
+				reportError(err)
+				return
+			}
+			rects = append(rects[:0], rect{x1: e.renderW, y1: e.renderH})
+		}
+		copyRects(e.dibPixels, e.renderBuffer, e.renderW, rects)
+
+		// Parts of the frame line up with the rest of the view only when the scale is an integer
+		if v.w%e.dibW != 0 || v.h%e.dibH != 0 {
+			rects = append(rects[:0], rect{x1: e.dibW, y1: e.dibH})
+		}
+		for _, r := range rects {
+			d := r.scaleTo(e.dibW, e.dibH, v.w, v.h)
+			w32.StretchBlt(hdc, v.x+d.x0, v.y+d.y0, d.x1-d.x0, d.y1-d.y0,
+				e.surfaceDC, r.x0, r.y0, r.x1-r.x0, r.y1-r.y0, w32.SRCCOPY)
+		}
+		return
+	}
+
+	if e.dibW != v.w || e.dibH != v.h {
+		if err := e.createDIB(v.w, v.h); err != nil {
+			reportError(err)
+			return
+		}
+		rects = append(rects[:0], rect{x1: e.renderW, y1: e.renderH})
+	}
+	e.presentRects = e.scaler.scaleRects(e.presentFilter, e.dibPixels, v.w, v.h, e.renderBuffer, e.renderW, e.renderH,
+		rects, e.presentRects[:0])
+	for _, d := range e.presentRects {
+		w32.BitBlt(hdc, v.x+d.x0, v.y+d.y0, d.x1-d.x0, d.y1-d.y0, e.surfaceDC, d.x0, d.y0, w32.SRCCOPY)
+	}
+}
+
+// copyRects copies the rectangles of an image w pixels wide from src to dst
+func copyRects(dst, src []Color, w int, rects []rect) {
+	for _, r := range rects {
+		for y := r.y0; y < r.y1; y++ {
+			copy(dst[y*w+r.x0:y*w+r.x1], src[y*w+r.x0:y*w+r.x1])
 		}
 	}
 }
@@ -202,13 +472,39 @@ func (e *windowsDriver) wndProc(hwnd w32.HWND, msg uint32, wParam uintptr, lPara
 	case w32.WM_DESTROY:
 		shutdown()
 		w32.PostQuitMessage(0)
+	case w32.WM_CLOSE:
+		// The update loop decides whether to quit, which destroys the window
+		iomgr.close()
+	case wmQuit:
+		w32.DestroyWindow(hwnd)
+	case w32.WM_SETFOCUS:
+		iomgr.setFocus(true)
+	case w32.WM_KILLFOCUS:
+		iomgr.setFocus(false)
 	case w32.WM_SIZE:
 		l := int(lParam)
-		e.scaleX = float64(l&0xffff) / float64(e.width)
-		e.scaleY = float64((l>>16)&0xffff) / float64(e.height)
+		w, h := l&0xffff, (l>>16)&0xffff
+		if w == 0 || h == 0 {
+			// The window is minimized
+			break
+		}
+		e.clientW, e.clientH = w, h
+		e.layout()
+		iomgr.resize(w, h)
 	case w32.WM_MOUSEMOVE:
 		l := int(lParam)
-		iomgr.updateMouse(l&0xffff, (l>>16)&0xffff)
+		e.motion(int(int16(l&0xffff)), int(int16((l>>16)&0xffff)))
+	case w32.WM_MOUSEWHEEL:
+		iomgr.scrollWheel(0, float64(int16(wParam>>16))/wheelDelta)
+	case w32.WM_MOUSEHWHEEL:
+		iomgr.scrollWheel(float64(int16(wParam>>16))/wheelDelta, 0)
+	case w32.WM_XBUTTONDOWN, w32.WM_XBUTTONUP:
+		key := Key(KeyMouseBack)
+		if (wParam>>16)&0xffff != w32.XBUTTON1 {
+			key = KeyMouseForward
+		}
+		iomgr.setKeyPressed(key, msg == w32.WM_XBUTTONDOWN)
+		return 1
 	case w32.WM_LBUTTONDOWN:
 		iomgr.setKeyPressed(KeyMouseLeft, true)
 	case w32.WM_LBUTTONUP:
@@ -222,22 +518,208 @@ func (e *windowsDriver) wndProc(hwnd w32.HWND, msg uint32, wParam uintptr, lPara
 	case w32.WM_MBUTTONUP:
 		iomgr.setKeyPressed(KeyMouseMiddle, false)
 	case w32.WM_KEYDOWN:
-		iomgr.setMappedKeyPressed(byte(wParam), true)
+		// Bit 30 is set when the key was already down, the message is generated by the auto repeat
+		if (lParam>>30)&1 != 0 {
+			iomgr.repeatKey(e.virtualKey(wParam, lParam))
+		} else {
+			iomgr.setKeyPressed(e.virtualKey(wParam, lParam), true)
+		}
 	case w32.WM_KEYUP:
-		iomgr.setMappedKeyPressed(byte(wParam), false)
+		iomgr.setKeyPressed(e.virtualKey(wParam, lParam), false)
+	case w32.WM_CHAR:
+		// Characters outside the basic multilingual plane are received as a pair of UTF-16 surrogates
+		ch := uint16(wParam)
+		switch {
+		case utf16.IsSurrogate(rune(ch)) && ch < 0xdc00:
+			e.highSurrogate = ch
+		case utf16.IsSurrogate(rune(ch)):
+			iomgr.addText(utf16.DecodeRune(rune(e.highSurrogate), rune(ch)))
+			e.highSurrogate = 0
+		default:
+			iomgr.addText(rune(ch))
+		}
+	case w32.WM_SYSKEYDOWN, w32.WM_SYSKEYUP:
+		// Alt and F10 are reported as system keys, they are passed on so that the system shortcuts like Alt+F4 keep working
+		switch {
+		case msg == w32.WM_SYSKEYUP:
+			iomgr.setKeyPressed(e.virtualKey(wParam, lParam), false)
+		case (lParam>>30)&1 != 0:
+			iomgr.repeatKey(e.virtualKey(wParam, lParam))
+		default:
+			iomgr.setKeyPressed(e.virtualKey(wParam, lParam), true)
+		}
+		return w32.DefWindowProc(hwnd, msg, wParam, lParam)
 
-	case w32.WM_USER + 0x100:
-		hdc := w32.GetDC(hwnd)
-		rc := w32.GetClientRect(hwnd)
-		w32.StretchBlt(hdc, 0, 0, int(rc.Right-rc.Left), int(rc.Bottom-rc.Top), e.surfaceDC, 0, 0, e.width, e.height, w32.SRCCOPY)
-		w32.ReleaseDC(hwnd, hdc)
+	case wmFullscreen:
+		e.setFullscreen(wParam != 0)
+	case wmScaleMode:
+		e.scaleMode = ScaleMode(wParam)
+		e.layout()
+		w32.InvalidateRect(hwnd, nil, true)
+	case wmRelativeMode:
+		e.setRelativeMouseMode(wParam != 0)
+	case wmPresent:
+		start := time.Now()
+		all := e.presentAll
+		e.presentAll = false
+		e.present(all)
+		presents.add(time.Since(start).Seconds())
 		atomic.StoreInt32(&e.rendering, 0)
+	case w32.WM_PAINT:
+		// Paint the whole view with the last frame, unless a frame is on its way which then paints it
+		var ps w32.PAINTSTRUCT
+		w32.BeginPaint(hwnd, &ps)
+		w32.EndPaint(hwnd, &ps)
+		e.presentAll = true
+		// The render buffer is only read while the rendering flag is held, there is nothing to paint before the
+		// first frame
+		if atomic.CompareAndSwapInt32(&e.rendering, 0, 1) {
+			if e.renderW != 0 {
+				e.presentAll = false
+				e.present(true)
+			}
+			atomic.StoreInt32(&e.rendering, 0)
+		}
 	default:
 		return w32.DefWindowProc(hwnd, msg, wParam, lParam)
 	}
 	return 0
 }
 
+// SetRelativeMouseMode hides the cursor and confines it to the window. The cursor is moved back to the
+// centre of the window after each mouse move message to measure the relative motion. The cursor is
+// changed by the window thread, because the cursor visibility is tracked per thread.
+func (e *windowsDriver) SetRelativeMouseMode(enabled bool) {
+	var state uintptr
+	if enabled {
+		state = 1
+	}
+	w32.PostMessage(e.hMainWnd, wmRelativeMode, state, 0)
+}
+
+func (e *windowsDriver) setRelativeMouseMode(enabled bool) {
+	if enabled {
+		if atomic.SwapInt32(&e.relative, 1) == 0 {
+			procShowCursor.Call(0)
+			rc := w32.GetWindowRect(e.hMainWnd)
+			procClipCursor.Call(uintptr(unsafe.Pointer(rc)))
+			e.centreCursor()
+		}
+	} else if atomic.SwapInt32(&e.relative, 0) == 1 {
+		procClipCursor.Call(0)
+		procShowCursor.Call(1)
+	}
+}
+
+// layout places the surface in the client area of the window according to the scale mode
+func (e *windowsDriver) layout() {
+	view, sw, sh := layoutView(e.scaleMode, e.clientW, e.clientH, e.baseW, e.baseH, e.sx, e.sy)
+	e.view = view
+	e.resize.request(sw, sh)
+	iomgr.setViewport(view, sw, sh)
+	e.presentAll = true
+}
+
+// SetFullscreen asks the window thread to switch the window between fullscreen and windowed
+func (e *windowsDriver) SetFullscreen(fullscreen bool) {
+	var state uintptr
+	if fullscreen {
+		state = 1
+	}
+	atomic.StoreInt32(&e.fullscreen, int32(state))
+	w32.PostMessage(e.hMainWnd, wmFullscreen, state, 0)
+}
+
+// Fullscreen returns true if the window is fullscreen
+func (e *windowsDriver) Fullscreen() bool {
+	return atomic.LoadInt32(&e.fullscreen) != 0
+}
+
+// setFullscreen switches the window between a borderless window that covers its monitor and its windowed
+// style and placement. The resize of the window lays out the surface.
+func (e *windowsDriver) setFullscreen(fullscreen bool) {
+	if fullscreen == e.isFullscreen {
+		return
+	}
+	e.isFullscreen = fullscreen
+
+	visible := uint32(w32.GetWindowLong(e.hMainWnd, w32.GWL_STYLE)) & w32.WS_VISIBLE
+	if fullscreen {
+		e.windowRect = *w32.GetWindowRect(e.hMainWnd)
+		mi := w32.MONITORINFO{CbSize: uint32(unsafe.Sizeof(w32.MONITORINFO{}))}
+		w32.GetMonitorInfo(w32.MonitorFromWindow(e.hMainWnd, w32.MONITOR_DEFAULTTONEAREST), &mi)
+		rc := mi.RcMonitor
+		w32.SetWindowLong(e.hMainWnd, w32.GWL_STYLE, w32.WS_POPUP|visible)
+		w32.SetWindowLong(e.hMainWnd, w32.GWL_EXSTYLE, w32.WS_EX_APPWINDOW)
+		w32.SetWindowPos(e.hMainWnd, w32.HWND_TOP, int(rc.Left), int(rc.Top), int(rc.Right-rc.Left), int(rc.Bottom-rc.Top),
+			w32.SWP_FRAMECHANGED|w32.SWP_NOOWNERZORDER)
+	} else {
+		rc := e.windowRect
+		w32.SetWindowLong(e.hMainWnd, w32.GWL_STYLE, uint32(e.style)|visible)
+		w32.SetWindowLong(e.hMainWnd, w32.GWL_EXSTYLE, uint32(e.exStyle))
+		w32.SetWindowPos(e.hMainWnd, 0, int(rc.Left), int(rc.Top), int(rc.Right-rc.Left), int(rc.Bottom-rc.Top),
+			w32.SWP_FRAMECHANGED|w32.SWP_NOZORDER|w32.SWP_NOOWNERZORDER)
+	}
+}
+
+// SetScaleMode asks the window thread to lay out the surface with the scale mode
+func (e *windowsDriver) SetScaleMode(mode ScaleMode) {
+	w32.PostMessage(e.hMainWnd, wmScaleMode, uintptr(mode), 0)
+	e.dirty.markAll()
+}
+
+// centre returns the centre of the client area of the window
+func (e *windowsDriver) centre() (int, int) {
+	rc := w32.GetClientRect(e.hMainWnd)
+	return int(rc.Right-rc.Left) / 2, int(rc.Bottom-rc.Top) / 2
+}
+
+func (e *windowsDriver) centreCursor() {
+	cx, cy := e.centre()
+	sx, sy := w32.ClientToScreen(e.hMainWnd, cx, cy)
+	w32.SetCursorPos(sx, sy)
+}
+
+// motion handles the motion of the mouse to x, y in client pixels
+func (e *windowsDriver) motion(x, y int) {
+	if atomic.LoadInt32(&e.relative) != 0 {
+		cx, cy := e.centre()
+		// Ignore the move generated by moving the cursor back to the centre
+		if x == cx && y == cy {
+			return
+		}
+		iomgr.moveMouse(x-cx, y-cy)
+		e.centreCursor()
+		return
+	}
+	iomgr.updateMouse(x, y)
+}
+
+// virtualKey maps the virtual key code of a key message to a key. The shift, control and alt keys
+// are distinguished as left or right keys using the scan code and extended key flag of the message.
+func (e *windowsDriver) virtualKey(wParam, lParam uintptr) Key {
+	scanCode := (lParam >> 16) & 0xff
+	extended := (lParam>>24)&1 != 0
+	switch wParam {
+	case w32.VK_SHIFT:
+		if scanCode == 0x36 {
+			return KeyRightShift
+		}
+		return KeyLeftShift
+	case w32.VK_CONTROL:
+		if extended {
+			return KeyRightControl
+		}
+		return KeyLeftControl
+	case w32.VK_MENU:
+		if extended {
+			return KeyRightAlt
+		}
+		return KeyLeftAlt
+	}
+	return iomgr.keymap[byte(wParam)]
+}
+
 //-----------------------------------------------------------------------------
 // Platform optimized routines
 
@@ -249,6 +731,7 @@ func (e *windowsDriver) Clear(c Color) {
 	// [1,1] copy to position 2 -> [1,1,1,1]
 	// [1,1,1,1] copy to position 4 [1,1,1,1,1,1,1,1] ...
 	// [1,1,1,1,1,1,1,1] copy to position 8 [1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1] ...
+	e.dirty.markAll()
 	e.backBuffer[0] = c
 	for i := 1; i < e.width*e.height; i *= 2 {
 		copy(e.backBuffer[i:], e.backBuffer[0:i])
@@ -261,6 +744,7 @@ func (e *windowsDriver) SetPixel(x, y int, c Color) {
 	if x < 0 || x >= e.width || y < 0 || y >= e.height {
 		return
 	}
+	e.dirty.markPixel(x, y)
 	p := (*Color)(unsafe.Add(e.backBufferPtr, (y*e.width+x)*4))
 	//p := (*Color)(unsafe.Pointer(uintptr(e.backBufferPtr + uintptr((y*e.width+x)*4))))
 	if c.A() != 255 {
@@ -272,7 +756,7 @@ func (e *windowsDriver) SetPixel(x, y int, c Color) {
 
 // FillRect platform optimized function to fill a rectangle in the background buffer. The rectangle is clipped to the boundaries of the buffer.
 func (e *windowsDriver) FillRect(x, y, w, h int, c Color) {
-	if x > e.width || y > e.height || x+w < 0 || y+h < 0 {
+	if x >= e.width || y >= e.height || x+w < 0 || y+h < 0 {
 		return
 	}
 
@@ -290,6 +774,7 @@ func (e *windowsDriver) FillRect(x, y, w, h int, c Color) {
 	if y+h > e.height {
 		h -= (y + h) - e.height
 	}
+	e.dirty.mark(x, y, x+w, y+h)
 
 	ptr := unsafe.Add(e.backBufferPtr, (y*e.width+x)*4)
 	//ptr := uintptr(e.backBufferPtr + uintptr((y*e.width+x)*4))
@@ -313,7 +798,7 @@ func (e *windowsDriver) FillRect(x, y, w, h int, c Color) {
 
 // DrawTexture platform optimized function to draw a texture to the background buffer. The texture is clipped to the boundaries of the buffer.
 func (e *windowsDriver) DrawTexture(x, y int, srcX, srcY, srcW, srcH int, t *Texture) {
-	if x > e.width || y > e.height || x+srcW < 0 || y+srcH < 0 || srcX >= t.W || srcY >= t.H {
+	if x >= e.width || y >= e.height || x+srcW < 0 || y+srcH < 0 || srcX >= t.W || srcY >= t.H {
 		return
 	}
 
@@ -370,6 +855,8 @@ func (e *windowsDriver) DrawTexture(x, y int, srcX, srcY, srcW, srcH int, t *Tex
 		y2 -= (y + y2) - e.height
 	}
 
+	e.dirty.mark(x+x1, y+y1, x+x2, y+y2)
+
 	textureRowOffset := uintptr((srcY+y1)*t.W + (srcX + x1))
 	bufferRowOffset := uintptr(y*e.width + x)
 
@@ -408,6 +895,7 @@ func (e *windowsDriver) HLine(x1, x2, y int, c Color) {
 	if x1 > x2 {
 		return
 	}
+	e.dirty.markSpan(y, x1, x2+1)
 
 	pixels := unsafe.Pointer(&e.backBuffer[0])
 	pixels = unsafe.Add(pixels, (y*e.width+x1)*4)
@@ -436,6 +924,7 @@ func (e *windowsDriver) VLine(x, y1, y2 int, c Color) {
 	if y1 > y2 {
 		return
 	}
+	e.dirty.mark(x, y1, x+1, y2+1)
 
 	pixels := unsafe.Pointer(&e.backBuffer[0])
 	pixels = unsafe.Add(pixels, (y1*e.width+x)*4)
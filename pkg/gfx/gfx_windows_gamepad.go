@@ -0,0 +1,128 @@
+//go:build windows && !headless
+// +build windows,!headless
+
+package gfx
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	xinputMaxUsers = 4
+
+	// xinputScanPeriod is the time in seconds between the checks for gamepads connected to unused slots,
+	// checking for gamepads that are not connected is slow
+	xinputScanPeriod = 1.0
+)
+
+var xinputButtons = []struct {
+	mask   uint16
+	button GamepadButton
+}{
+	{0x0001, GamepadDPadUp},
+	{0x0002, GamepadDPadDown},
+	{0x0004, GamepadDPadLeft},
+	{0x0008, GamepadDPadRight},
+	{0x0010, GamepadStart},
+	{0x0020, GamepadBack},
+	{0x0040, GamepadLeftStick},
+	{0x0080, GamepadRightStick},
+	{0x0100, GamepadLeftShoulder},
+	{0x0200, GamepadRightShoulder},
+	{0x1000, GamepadA},
+	{0x2000, GamepadB},
+	{0x4000, GamepadX},
+	{0x8000, GamepadY},
+}
+
+type xinputState struct {
+	packetNumber uint32
+	buttons      uint16
+	leftTrigger  byte
+	rightTrigger byte
+	thumbLX      int16
+	thumbLY      int16
+	thumbRX      int16
+	thumbRY      int16
+}
+
+// xinputPoller polls the XInput gamepads from the update loop
+type xinputPoller struct {
+	getState *syscall.LazyProc
+	pads     [xinputMaxUsers]int
+	packets  [xinputMaxUsers]uint32
+	elapsed  float64
+}
+
+func newXInputPoller() *xinputPoller {
+	p := &xinputPoller{elapsed: xinputScanPeriod}
+	for _, name := range []string{"xinput1_4.dll", "xinput9_1_0.dll"} {
+		dll := syscall.NewLazyDLL(name)
+		if dll.Load() == nil {
+			p.getState = dll.NewProc("XInputGetState")
+			break
+		}
+	}
+	for i := range p.pads {
+		p.pads[i] = -1
+	}
+	return p
+}
+
+func (p *xinputPoller) poll(delta float64) {
+	if p.getState == nil {
+		return
+	}
+
+	p.elapsed += delta
+	scan := p.elapsed >= xinputScanPeriod
+	if scan {
+		p.elapsed = 0
+	}
+
+	for user := range p.pads {
+		pad := p.pads[user]
+		if pad < 0 && !scan {
+			continue
+		}
+
+		var state xinputState
+		r, _, _ := p.getState.Call(uintptr(user), uintptr(unsafe.Pointer(&state)))
+		if r != 0 {
+			if pad >= 0 {
+				iomgr.disconnectGamepad(pad)
+				p.pads[user] = -1
+			}
+			continue
+		}
+
+		if pad < 0 {
+			if pad = iomgr.connectGamepad("XInput Controller"); pad < 0 {
+				continue
+			}
+			p.pads[user] = pad
+		} else if state.packetNumber == p.packets[user] {
+			continue
+		}
+		p.packets[user] = state.packetNumber
+
+		for _, xb := range xinputButtons {
+			iomgr.setGamepadButton(pad, xb.button, state.buttons&xb.mask != 0)
+		}
+		// XInput reports the stick Y axes positive up
+		iomgr.setGamepadAxis(pad, GamepadLeftX, thumbAxis(state.thumbLX))
+		iomgr.setGamepadAxis(pad, GamepadLeftY, -thumbAxis(state.thumbLY))
+		iomgr.setGamepadAxis(pad, GamepadRightX, thumbAxis(state.thumbRX))
+		iomgr.setGamepadAxis(pad, GamepadRightY, -thumbAxis(state.thumbRY))
+		iomgr.setGamepadAxis(pad, GamepadLeftTrigger, float64(state.leftTrigger)/255)
+		iomgr.setGamepadAxis(pad, GamepadRightTrigger, float64(state.rightTrigger)/255)
+	}
+}
+
+func thumbAxis(v int16) float64 {
+	if v < 0 {
+		return float64(v) / 32768
+	}
+	return float64(v) / 32767
+}
@@ -0,0 +1,141 @@
+package gfx
+
+// rect is a rectangle of pixels from x0, y0 up to, but excluding, x1, y1
+type rect struct {
+	x0, y0, x1, y1 int
+}
+
+func (r rect) empty() bool {
+	return r.x0 >= r.x1 || r.y0 >= r.y1
+}
+
+// grow returns the rectangle grown by m pixels on every side, clipped to an image of w x h pixels
+func (r rect) grow(m, w, h int) rect {
+	return rect{x0: max(r.x0-m, 0), y0: max(r.y0-m, 0), x1: min(r.x1+m, w), y1: min(r.y1+m, h)}
+}
+
+// scaleTo returns the rectangle of an image of dstW x dstH pixels that covers the rectangle of an image of w x h
+// pixels scaled to it
+func (r rect) scaleTo(w, h, dstW, dstH int) rect {
+	return rect{
+		x0: r.x0 * dstW / w,
+		y0: r.y0 * dstH / h,
+		x1: min((r.x1*dstW+w-1)/w, dstW),
+		y1: min((r.y1*dstH+h-1)/h, dstH),
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// dirtyRegion tracks the pixels of the back buffer drawn since the last frame was presented, as the span of
+// columns drawn in every row. The drawing functions of the drivers mark the pixels they change, and the rows
+// are combined into rectangles when the frame is presented.
+type dirtyRegion struct {
+	w, h  int
+	all   bool
+	full  bool
+	spans []span
+}
+
+// span is a range of columns from x0 up to, but excluding, x1, it is empty when x0 >= x1
+type span struct {
+	x0, x1 int
+}
+
+// reset sizes the region for a back buffer of w x h pixels and marks all of it
+func (d *dirtyRegion) reset(w, h int) {
+	d.w, d.h = w, h
+	d.spans = make([]span, h)
+	d.markAll()
+}
+
+func (d *dirtyRegion) markAll() {
+	d.all = true
+}
+
+// setFull stops tracking the drawn pixels, every frame is presented in full. This saves the cost of tracking
+// for applications that draw the whole surface every frame.
+func (d *dirtyRegion) setFull(full bool) {
+	d.full = full
+	d.all = true
+}
+
+// mark marks the pixels of a rectangle that is inside the back buffer
+func (d *dirtyRegion) mark(x0, y0, x1, y1 int) {
+	if d.all {
+		return
+	}
+	for y := y0; y < y1; y++ {
+		d.markSpan(y, x0, x1)
+	}
+}
+
+// markSpan marks the pixels from x0 up to x1 of row y, which is inside the back buffer
+func (d *dirtyRegion) markSpan(y, x0, x1 int) {
+	if d.all || x0 >= x1 {
+		return
+	}
+	s := &d.spans[y]
+	if s.x0 >= s.x1 {
+		s.x0, s.x1 = x0, x1
+		return
+	}
+	if x0 < s.x0 {
+		s.x0 = x0
+	}
+	if x1 > s.x1 {
+		s.x1 = x1
+	}
+}
+
+// markPixel marks the pixel at x, y, which is inside the back buffer
+func (d *dirtyRegion) markPixel(x, y int) {
+	d.markSpan(y, x, x+1)
+}
+
+// take appends the rectangles that cover the marked pixels to rects and clears the region. Consecutive marked
+// rows are combined into one rectangle as wide as the widest of them.
+func (d *dirtyRegion) take(rects []rect) []rect {
+	if d.all {
+		d.all = d.full
+		for i := range d.spans {
+			d.spans[i] = span{}
+		}
+		return append(rects, rect{x1: d.w, y1: d.h})
+	}
+
+	var r rect
+	for y, s := range d.spans {
+		if s.x0 >= s.x1 {
+			if !r.empty() {
+				rects = append(rects, r)
+				r = rect{}
+			}
+			continue
+		}
+		d.spans[y] = span{}
+		if r.empty() {
+			r = rect{x0: s.x0, y0: y, x1: s.x1, y1: y + 1}
+			continue
+		}
+		r.x0 = min(r.x0, s.x0)
+		r.x1 = max(r.x1, s.x1)
+		r.y1 = y + 1
+	}
+	if !r.empty() {
+		rects = append(rects, r)
+	}
+	return rects
+}
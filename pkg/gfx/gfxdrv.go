@@ -1,18 +1,44 @@
 package gfx
 
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrConnectionClosed is returned by Run when the connection to the display is lost while the application is running
+var ErrConnectionClosed = errors.New("gfx: connection to the display closed")
+
+// defaultRefreshPeriod is the time between the frames presented to the window when the refresh rate of the display is not known
+const defaultRefreshPeriod = 1.0 / 60.0
+
 var (
 	iomgr   *ioManager
 	driver  platformDriver
-	running bool
+	running int32
+
+	// headless is set by the headless driver, which has no window and no input of its own
+	headless bool
+
+	errMu     sync.Mutex
+	driverErr error
 )
 
 type platformDriver interface {
 	Init() error
-	CreateWindow(x, y, w, h, xscale, yscale int) bool
-	CreateDevice() bool
-	StartEventLoop()
+	CreateWindow(cfg Config) error
+	CreateDevice() error
+	StartEventLoop() error
+	Quit()
 	Render(delta float64)
+	PresentPeriod() float64
 	SetWindowTitle(title string)
+	SetWindowVisible(visible bool)
+	SetScaleMode(mode ScaleMode)
+	SetPresentFilter(filter PresentFilter)
+	SetFullscreen(fullscreen bool)
+	Fullscreen() bool
+	SetRelativeMouseMode(enabled bool)
 
 	Update(delta float64)
 
@@ -23,3 +49,25 @@ type platformDriver interface {
 	HLine(x1, x2, y int, c Color)
 	VLine(x, y1, y2 int, c Color)
 }
+
+// reportError keeps the first error reported by the driver while the application is running, Run returns it.
+// Errors reported while the application shuts down, like requests to a window that was destroyed, are ignored.
+func reportError(err error) {
+	if err == nil || atomic.LoadInt32(&running) == 0 {
+		return
+	}
+	errMu.Lock()
+	if driverErr == nil {
+		driverErr = err
+	}
+	errMu.Unlock()
+}
+
+// takeError returns the error reported by the driver and clears it
+func takeError() error {
+	errMu.Lock()
+	defer errMu.Unlock()
+	err := driverErr
+	driverErr = nil
+	return err
+}
@@ -0,0 +1,77 @@
+package gfx
+
+import "time"
+
+// EventType identifies the kind of an event
+type EventType int
+
+// Event types
+const (
+	EventNone EventType = iota
+	EventKeyDown
+	EventKeyUp
+	EventMouseDown
+	EventMouseUp
+	EventMouseMove
+	EventMouseWheel
+	EventText
+	EventFocusGained
+	EventFocusLost
+	EventResize
+	EventClose
+	EventGamepadConnected
+	EventGamepadDisconnected
+	EventGamepadButtonDown
+	EventGamepadButtonUp
+	EventGamepadAxis
+)
+
+// Event is an input or window event received from the platform
+type Event struct {
+	Type EventType
+
+	// Time is the time the event was received from the platform
+	Time time.Time
+
+	// Key is the key of key events or the mouse button of mouse button events
+	Key Key
+
+	// Repeat is true for key down events generated by the auto repeat of a key that is held down
+	Repeat bool
+
+	// X, Y are the coordinates of the mouse for mouse events
+	X, Y float64
+
+	// DX, DY are the distance the mouse moved for mouse move events, or the number of notches
+	// scrolled for mouse wheel events
+	DX, DY float64
+
+	// Char is the character typed for text events, text events are only received while text input is active
+	Char rune
+
+	// W, H are the size of the window in window pixels for resize events
+	W, H int
+
+	// Gamepad is the slot of the gamepad for gamepad events
+	Gamepad int
+
+	// Name is the name of the gamepad for gamepad connected events
+	Name string
+
+	// Button is the button of gamepad button events
+	Button GamepadButton
+
+	// Axis is the axis of gamepad axis events
+	Axis GamepadAxis
+
+	// Value is the position of the axis for gamepad axis events, or 1 for button down and 0 for button up events
+	Value float64
+}
+
+// PollEvent returns the next event received before the current update frame, in the order the events occurred.
+// ok is false when there are no more events. Events that are not polled during the update frame are discarded.
+// The polled input functions like KeyPressed and KeyJustPressed reflect all the events of the frame, whether
+// they are polled or not.
+func PollEvent() (ev Event, ok bool) {
+	return iomgr.pollEvent()
+}
@@ -0,0 +1,390 @@
+package gfx
+
+import "math"
+
+// PresentFilter defines how the graphics surface is filtered when it is scaled to the window
+type PresentFilter int
+
+// Present filters
+const (
+	// FilterNearest duplicates the pixels of the surface, which keeps them sharp
+	FilterNearest PresentFilter = iota
+
+	// FilterBilinear interpolates between the pixels of the surface, which smooths the image
+	FilterBilinear
+
+	// FilterScanlines duplicates the pixels and darkens the last window row of every surface row, like the scanlines
+	// of a television. The scanlines need a vertical scale of at least 2.
+	FilterScanlines
+
+	// FilterCRT curves the image like the glass of a CRT monitor, darkens it towards the edges and adds scanlines
+	FilterCRT
+
+	// FilterScale2x doubles the surface with the Scale2x pixel art algorithm, which rounds the steps of diagonal
+	// edges, and then scales it to the window
+	FilterScale2x
+
+	// FilterHQ2x doubles the surface in the style of hq2x, blending the pixels along the edges it finds between
+	// similar colors, and then scales it to the window
+	FilterHQ2x
+)
+
+const (
+	// scanlineShade is the brightness of a scanline, out of 256
+	scanlineShade = 160
+
+	// crtCurvature is how far the image bulges at the edges of the screen
+	crtCurvature = 0.08
+
+	// crtVignette is the power of the darkening towards the edges of the screen
+	crtVignette = 0.2
+
+	// Thresholds of the differences in luma and chroma under which hq2x treats two colors as similar
+	hqThresholdY = 48
+	hqThresholdU = 7
+	hqThresholdV = 6
+)
+
+// SetPresentFilter sets the filter applied when the graphics surface is scaled to the window. The default is
+// FilterNearest, or the filter set by Config.Filter.
+func SetPresentFilter(filter PresentFilter) {
+	driver.SetPresentFilter(filter)
+}
+
+// presentScaler scales the frames to the size of the view with a present filter. Only the part of the view scaled
+// from the pixels that changed is updated, unless the filter or the sizes changed since the last frame. The tables it
+// keeps for a filter are rebuilt when the sizes change.
+type presentScaler struct {
+	filter PresentFilter
+	sizes  [4]int
+
+	// xmap holds the source column of each column of the view
+	xmap          []int
+	xmapSrcW      int
+	doubled       []Color
+	crtIndex      []int32
+	crtShade      []uint16
+	crtSizes      [4]int
+	bilinearX     []bilinearSample
+	bilinearSizes [2]int
+}
+
+// bilinearSample is a pair of neighbouring source pixels and the weight of the second, out of 256
+type bilinearSample struct {
+	i0, i1 int
+	t      uint32
+}
+
+// scale scales the rectangle r of the src image of srcW x srcH pixels into the dst image of dstW x dstH pixels,
+// and returns the rectangle of the dst image that was updated
+func (s *presentScaler) scale(filter PresentFilter, dst []Color, dstW, dstH int, src []Color, srcW, srcH int, r rect) rect {
+	if filter != s.filter || s.sizes != [4]int{dstW, dstH, srcW, srcH} {
+		s.filter = filter
+		s.sizes = [4]int{dstW, dstH, srcW, srcH}
+		r = rect{x1: srcW, y1: srcH}
+	}
+
+	switch filter {
+	case FilterBilinear:
+		// The pixels either side of a changed pixel are interpolated with it
+		d := r.grow(2, srcW, srcH).scaleTo(srcW, srcH, dstW, dstH)
+		s.bilinear(dst, dstW, dstH, src, srcW, srcH, d)
+		return d
+	case FilterScanlines:
+		d := r.scaleTo(srcW, srcH, dstW, dstH)
+		s.nearest(dst, dstW, dstH, src, srcW, srcH, d)
+		scanlines(dst, dstW, dstH, srcH, d)
+		return d
+	case FilterCRT:
+		s.crt(dst, dstW, dstH, src, srcW, srcH)
+		return rect{x1: dstW, y1: dstH}
+	case FilterScale2x, FilterHQ2x:
+		if len(s.doubled) != srcW*srcH*4 {
+			s.doubled = make([]Color, srcW*srcH*4)
+		}
+		// The doubled pixels depend on the neighbours of the pixel
+		g := r.grow(1, srcW, srcH)
+		if filter == FilterScale2x {
+			scale2x(s.doubled, src, srcW, srcH, g)
+		} else {
+			hq2x(s.doubled, src, srcW, srcH, g)
+		}
+		g = rect{x0: g.x0 * 2, y0: g.y0 * 2, x1: g.x1 * 2, y1: g.y1 * 2}
+		d := g.scaleTo(srcW*2, srcH*2, dstW, dstH)
+		s.nearest(dst, dstW, dstH, s.doubled, srcW*2, srcH*2, d)
+		return d
+	default:
+		d := r.scaleTo(srcW, srcH, dstW, dstH)
+		s.nearest(dst, dstW, dstH, src, srcW, srcH, d)
+		return d
+	}
+}
+
+// scaleRects scales the rectangles of the src image like scale and appends the rectangles of the dst image that were
+// updated to out. A rectangle that covers the whole dst image is the only one appended.
+func (s *presentScaler) scaleRects(filter PresentFilter, dst []Color, dstW, dstH int, src []Color, srcW, srcH int, rects, out []rect) []rect {
+	full := rect{x1: dstW, y1: dstH}
+	n := len(out)
+	for _, r := range rects {
+		d := s.scale(filter, dst, dstW, dstH, src, srcW, srcH, r)
+		if d == full {
+			return append(out[:n], d)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// nearest scales the image into the rectangle d of the dst image sampling the nearest pixel
+func (s *presentScaler) nearest(dst []Color, dstW, dstH int, src []Color, srcW, srcH int, d rect) {
+	if srcW == dstW && srcH == dstH {
+		for y := d.y0; y < d.y1; y++ {
+			copy(dst[y*dstW+d.x0:y*dstW+d.x1], src[y*srcW+d.x0:y*srcW+d.x1])
+		}
+		return
+	}
+	if len(s.xmap) != dstW || s.xmapSrcW != srcW {
+		s.xmap = make([]int, dstW)
+		for x := range s.xmap {
+			s.xmap[x] = x * srcW / dstW
+		}
+		s.xmapSrcW = srcW
+	}
+	prev := -1
+	for y := d.y0; y < d.y1; y++ {
+		row := dst[y*dstW+d.x0 : y*dstW+d.x1]
+		sy := y * srcH / dstH
+		if sy == prev {
+			// Rows scaled from the same source row are copies of the previous row
+			copy(row, dst[(y-1)*dstW+d.x0:(y-1)*dstW+d.x1])
+			continue
+		}
+		prev = sy
+		srcRow := src[sy*srcW : (sy+1)*srcW]
+		for x, sx := range s.xmap[d.x0:d.x1] {
+			row[x] = srcRow[sx]
+		}
+	}
+}
+
+// bilinear scales the image into the rectangle d of the dst image interpolating between the four nearest pixels
+func (s *presentScaler) bilinear(dst []Color, dstW, dstH int, src []Color, srcW, srcH int, d rect) {
+	if s.bilinearSizes != [2]int{dstW, srcW} {
+		s.bilinearX = make([]bilinearSample, dstW)
+		for x := range s.bilinearX {
+			s.bilinearX[x] = bilinearAt(x, dstW, srcW)
+		}
+		s.bilinearSizes = [2]int{dstW, srcW}
+	}
+	for y := d.y0; y < d.y1; y++ {
+		ys := bilinearAt(y, dstH, srcH)
+		row0 := src[ys.i0*srcW : (ys.i0+1)*srcW]
+		row1 := src[ys.i1*srcW : (ys.i1+1)*srcW]
+		row := dst[y*dstW+d.x0 : y*dstW+d.x1]
+		for x, xs := range s.bilinearX[d.x0:d.x1] {
+			top := lerpColor(row0[xs.i0], row0[xs.i1], xs.t)
+			bottom := lerpColor(row1[xs.i0], row1[xs.i1], xs.t)
+			row[x] = lerpColor(top, bottom, ys.t)
+		}
+	}
+}
+
+// bilinearAt returns the source pixels either side of the centre of pixel i of n, scaled from srcN pixels
+func bilinearAt(i, n, srcN int) bilinearSample {
+	p := (float64(i)+0.5)*float64(srcN)/float64(n) - 0.5
+	if p < 0 {
+		p = 0
+	}
+	i0 := int(p)
+	i1 := i0 + 1
+	if i1 >= srcN {
+		i1 = srcN - 1
+	}
+	return bilinearSample{i0: i0, i1: i1, t: uint32((p - float64(i0)) * 256)}
+}
+
+// scanlines darkens the last row of the view scaled from every source row, in the rectangle d of the view
+func scanlines(dst []Color, dstW, dstH, srcH int, d rect) {
+	if dstH < srcH*2 {
+		return
+	}
+	for y := d.y0; y < d.y1; y++ {
+		if y+1 < dstH && (y+1)*srcH/dstH == y*srcH/dstH {
+			continue
+		}
+		row := dst[y*dstW+d.x0 : y*dstW+d.x1]
+		for x, c := range row {
+			row[x] = shadeColor(c, scanlineShade)
+		}
+	}
+}
+
+// crt scales the image through a barrel distortion, darkening it towards the edges and adding scanlines. The
+// source pixel and the shade of every pixel of the view are calculated once for the sizes.
+func (s *presentScaler) crt(dst []Color, dstW, dstH int, src []Color, srcW, srcH int) {
+	if s.crtSizes != [4]int{dstW, dstH, srcW, srcH} {
+		s.buildCRT(dstW, dstH, srcW, srcH)
+	}
+	for i, si := range s.crtIndex {
+		if si < 0 {
+			dst[i] = Black
+			continue
+		}
+		dst[i] = shadeColor(src[si], uint32(s.crtShade[i]))
+	}
+}
+
+func (s *presentScaler) buildCRT(dstW, dstH, srcW, srcH int) {
+	s.crtIndex = make([]int32, dstW*dstH)
+	s.crtShade = make([]uint16, dstW*dstH)
+	s.crtSizes = [4]int{dstW, dstH, srcW, srcH}
+	lines := dstH >= srcH*2
+	for y := 0; y < dstH; y++ {
+		v := 2*(float64(y)+0.5)/float64(dstH) - 1
+		for x := 0; x < dstW; x++ {
+			i := y*dstW + x
+			u := 2*(float64(x)+0.5)/float64(dstW) - 1
+			cu := u * (1 + crtCurvature*v*v)
+			cv := v * (1 + crtCurvature*u*u)
+			if cu <= -1 || cu >= 1 || cv <= -1 || cv >= 1 {
+				s.crtIndex[i] = -1
+				continue
+			}
+			fx := (cu + 1) / 2 * float64(srcW)
+			fy := (cv + 1) / 2 * float64(srcH)
+			sx, sy := int(fx), int(fy)
+			shade := math.Pow((1-cu*cu)*(1-cv*cv), crtVignette)
+			if lines && fy-float64(sy) >= 0.5 {
+				shade *= scanlineShade / 256.0
+			}
+			s.crtIndex[i] = int32(sy*srcW + sx)
+			s.crtShade[i] = uint16(shade * 256)
+		}
+	}
+}
+
+// scale2x doubles the rectangle r of the image with the Scale2x algorithm. Each pixel becomes four, a corner takes the color of the
+// two neighbours it touches when they are the same and the pixel is not part of a line through them.
+func scale2x(dst, src []Color, w, h int, r rect) {
+	dw := w * 2
+	for y := r.y0; y < r.y1; y++ {
+		for x := r.x0; x < r.x1; x++ {
+			p, a, b, c, d := neighbours(src, w, h, x, y)
+			e0, e1, e2, e3 := p, p, p, p
+			if a != d && b != c {
+				if c == a {
+					e0 = a
+				}
+				if a == b {
+					e1 = b
+				}
+				if c == d {
+					e2 = c
+				}
+				if d == b {
+					e3 = d
+				}
+			}
+			i := y*2*dw + x*2
+			dst[i], dst[i+1] = e0, e1
+			dst[i+dw], dst[i+dw+1] = e2, e3
+		}
+	}
+}
+
+// hq2x doubles the rectangle r of the image in the style of hq2x. It finds the same edges as Scale2x, comparing colors by their
+// luma and chroma so that shades of a color match, and blends the corners along an edge instead of replacing them.
+func hq2x(dst, src []Color, w, h int, r rect) {
+	dw := w * 2
+	for y := r.y0; y < r.y1; y++ {
+		for x := r.x0; x < r.x1; x++ {
+			p, a, b, c, d := neighbours(src, w, h, x, y)
+			e0, e1, e2, e3 := p, p, p, p
+			if !similar(a, d) && !similar(b, c) {
+				if similar(c, a) {
+					e0 = blend4(p, p, a, c)
+				}
+				if similar(a, b) {
+					e1 = blend4(p, p, a, b)
+				}
+				if similar(c, d) {
+					e2 = blend4(p, p, c, d)
+				}
+				if similar(d, b) {
+					e3 = blend4(p, p, b, d)
+				}
+			}
+			i := y*2*dw + x*2
+			dst[i], dst[i+1] = e0, e1
+			dst[i+dw], dst[i+dw+1] = e2, e3
+		}
+	}
+}
+
+// neighbours returns the pixel at x, y and the pixels above, right, left and below it, repeating the pixels at
+// the edges of the image
+func neighbours(src []Color, w, h, x, y int) (p, a, b, c, d Color) {
+	i := y*w + x
+	p, a, b, c, d = src[i], src[i], src[i], src[i], src[i]
+	if y > 0 {
+		a = src[i-w]
+	}
+	if x < w-1 {
+		b = src[i+1]
+	}
+	if x > 0 {
+		c = src[i-1]
+	}
+	if y < h-1 {
+		d = src[i+w]
+	}
+	return
+}
+
+// similar returns true if the luma and chroma of two colors differ less than the hq2x thresholds
+func similar(c1, c2 Color) bool {
+	if c1 == c2 {
+		return true
+	}
+	y1, u1, v1 := yuv(c1)
+	y2, u2, v2 := yuv(c2)
+	return abs(y1-y2) <= hqThresholdY && abs(u1-u2) <= hqThresholdU && abs(v1-v2) <= hqThresholdV
+}
+
+// yuv returns the luma and chroma of a color
+func yuv(c Color) (y, u, v int) {
+	r, g, b := c.R(), c.G(), c.B()
+	y = (299*r + 587*g + 114*b) / 1000
+	u = (-169*r-331*g+500*b)/1000 + 128
+	v = (500*r-419*g-81*b)/1000 + 128
+	return
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// lerpColor interpolates between two colors, t is the weight of the second color out of 256. The red and blue
+// components, and the alpha and green components, are interpolated together.
+func lerpColor(c1, c2 Color, t uint32) Color {
+	a, b := uint32(c1), uint32(c2)
+	rb := ((a&0xff00ff)*(256-t) + (b&0xff00ff)*t) >> 8 & 0xff00ff
+	ag := ((a>>8&0xff00ff)*(256-t) + (b>>8&0xff00ff)*t) & 0xff00ff00
+	return Color(rb | ag)
+}
+
+// shadeColor scales the brightness of a color by k out of 256, keeping its alpha
+func shadeColor(c Color, k uint32) Color {
+	v := uint32(c)
+	rb := (v & 0xff00ff) * k >> 8 & 0xff00ff
+	g := (v & 0xff00) * k >> 8 & 0xff00
+	return Color(v&0xff000000 | rb | g)
+}
+
+// blend4 returns the average of four colors
+func blend4(c1, c2, c3, c4 Color) Color {
+	return lerpColor(lerpColor(c1, c2, 128), lerpColor(c3, c4, 128), 128)
+}
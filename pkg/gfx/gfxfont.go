@@ -0,0 +1,604 @@
+package gfx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrInvalidPSF is returned by LoadPSF when the data is not a PSF1 or PSF2 font
+	ErrInvalidPSF = errors.New("gfx: invalid psf font")
+
+	// ErrInvalidBDF is returned by LoadBDF when the data is not a valid BDF font
+	ErrInvalidBDF = errors.New("gfx: invalid bdf font")
+
+	// ErrInvalidFont is returned by NewFont when the glyphs do not describe a font
+	ErrInvalidFont = errors.New("gfx: invalid font")
+)
+
+// rowBytes returns the number of bytes used to store a single row of a glyph.
+// Rows are stored most significant bit first and padded to a whole byte.
+func (f *Font) rowBytes() int {
+	return (f.W + 7) / 8
+}
+
+// glyphBytes returns the number of bytes used to store a single glyph
+func (f *Font) glyphBytes() int {
+	return f.rowBytes() * f.H
+}
+
+// GlyphMetrics describes how a glyph is positioned relative to the pen when rendering proportional text
+type GlyphMetrics struct {
+	// Advance is the distance the pen moves after rendering the glyph
+	Advance int
+	// Bearing is the horizontal offset from the pen to the left edge of the glyph cell
+	Bearing int
+}
+
+type kernPair struct {
+	left, right rune
+}
+
+// maxFallbackDepth limits the length of a font fallback chain, guarding against cycles
+const maxFallbackDepth = 8
+
+// glyphCount returns the number of glyphs stored in the font
+func (f *Font) glyphCount() int {
+	return len(f.data) / f.glyphBytes()
+}
+
+// lookup returns the index of the glyph for ch in the font, ignoring the fallback chain
+func (f *Font) lookup(ch rune) (int, bool) {
+	if f.index != nil {
+		i, ok := f.index[ch]
+		return i, ok
+	}
+	if ch < rune(f.FirstChar) || ch > rune(f.LastChar) {
+		return 0, false
+	}
+	return int(ch) - int(f.FirstChar), true
+}
+
+// glyph returns the font and glyph index used to render ch. The fallback chain is searched for fonts
+// that do not have a glyph for ch, if no font has the glyph the default character of f is used.
+func (f *Font) glyph(ch rune) (*Font, int) {
+	fb := f
+	for i := 0; fb != nil && i < maxFallbackDepth; i++ {
+		if idx, ok := fb.lookup(ch); ok {
+			return fb, idx
+		}
+		fb = fb.Fallback
+	}
+	idx, _ := f.lookup(f.DefaultChar)
+	return f, idx
+}
+
+// HasGlyph returns true if the font, excluding its fallback fonts, has a glyph for ch
+func (f *Font) HasGlyph(ch rune) bool {
+	_, ok := f.lookup(ch)
+	return ok
+}
+
+// GlyphMetrics returns the metrics of the glyph used to render ch.
+// Fonts without per-glyph metrics advance by the font width.
+func (f *Font) GlyphMetrics(ch rune) GlyphMetrics {
+	gf, idx := f.glyph(ch)
+	if gf.metrics == nil {
+		return GlyphMetrics{Advance: gf.W}
+	}
+	return gf.metrics[idx]
+}
+
+// SetGlyphMetrics sets the metrics of the glyph used to render ch, making the font proportional.
+// The metrics are ignored if the font does not have a glyph for ch.
+func (f *Font) SetGlyphMetrics(ch rune, m GlyphMetrics) {
+	idx, ok := f.lookup(ch)
+	if !ok {
+		return
+	}
+	if f.metrics == nil {
+		f.metrics = make([]GlyphMetrics, f.glyphCount())
+		for i := range f.metrics {
+			f.metrics[i].Advance = f.W
+		}
+	}
+	f.metrics[idx] = m
+}
+
+// Kerning returns the adjustment applied to the pen position between the left and right characters
+func (f *Font) Kerning(left, right rune) int {
+	return f.kerning[kernPair{left, right}]
+}
+
+// SetKerning sets the adjustment applied to the pen position between the left and right characters.
+// A negative adjustment moves the characters closer together.
+func (f *Font) SetKerning(left, right rune, adjust int) {
+	if f.kerning == nil {
+		f.kerning = make(map[kernPair]int)
+	}
+	if adjust == 0 {
+		delete(f.kerning, kernPair{left, right})
+		return
+	}
+	f.kerning[kernPair{left, right}] = adjust
+}
+
+// Proportional returns a proportional version of a fixed width font. The metrics of each glyph
+// are derived from the pixels set in the glyph, and spacing pixels are added between characters.
+// Empty glyphs, like space, advance by half the font width. The glyph data is shared with f.
+func Proportional(f *Font, spacing int) *Font {
+	p := &Font{
+		W:           f.W,
+		H:           f.H,
+		FirstChar:   f.FirstChar,
+		LastChar:    f.LastChar,
+		DefaultChar: f.DefaultChar,
+		Fallback:    f.Fallback,
+		data:        f.data,
+		index:       f.index,
+		metrics:     make([]GlyphMetrics, f.glyphCount()),
+	}
+	for i := range p.metrics {
+		left, right := f.inkExtents(i)
+		if left > right {
+			p.metrics[i] = GlyphMetrics{Advance: (f.W + 1) / 2}
+		} else {
+			p.metrics[i] = GlyphMetrics{Advance: right - left + 1 + spacing, Bearing: -left}
+		}
+	}
+	return p
+}
+
+// inkExtents returns the left most and right most columns with pixels set in a glyph.
+// For an empty glyph left is greater than right.
+func (f *Font) inkExtents(glyph int) (left, right int) {
+	left, right = f.W, -1
+	rb := f.rowBytes()
+	row := glyph * f.glyphBytes()
+	for i := 0; i < f.H; i++ {
+		for j := 0; j < f.W; j++ {
+			if f.data[row+j/8]&(0x80>>(j%8)) != 0 {
+				if j < left {
+					left = j
+				}
+				if j > right {
+					right = j
+				}
+			}
+		}
+		row += rb
+	}
+	return left, right
+}
+
+// NewFont creates a font of w by h pixel glyphs. Each row of a glyph is stored in (w+7)/8 bytes of data, most
+// significant bit first. chars lists the character of each glyph in data and metrics, which can be nil for a fixed
+// width font, lists the metrics of each glyph. ErrInvalidFont is returned when the size of the glyphs is not
+// positive, there are no glyphs, or data or metrics do not have an entry for every glyph.
+func NewFont(w, h int, chars []rune, data []byte, metrics []GlyphMetrics) (*Font, error) {
+	if w <= 0 || h <= 0 || len(chars) == 0 || len(data) < len(chars)*((w+7)/8)*h ||
+		(metrics != nil && len(metrics) < len(chars)) {
+		return nil, ErrInvalidFont
+	}
+
+	dense := true
+	for i, ch := range chars {
+		if ch != chars[0]+rune(i) || ch < 0 || ch > 255 {
+			dense = false
+			break
+		}
+	}
+
+	var f *Font
+	if dense {
+		f = newFont(w, h, byte(chars[0]), byte(chars[len(chars)-1]))
+	} else {
+		f = newSparseFont(w, h, len(chars))
+		for i, ch := range chars {
+			f.index[ch] = i
+		}
+		f.updateCharRange()
+	}
+	copy(f.data, data)
+	if metrics != nil {
+		f.metrics = make([]GlyphMetrics, len(chars))
+		copy(f.metrics, metrics)
+	}
+	return f, nil
+}
+
+// Chars returns the characters that the font has glyphs for in ascending order, excluding its fallback fonts
+func (f *Font) Chars() []rune {
+	var chars []rune
+	if f.index == nil {
+		for ch := rune(f.FirstChar); ch <= rune(f.LastChar); ch++ {
+			chars = append(chars, ch)
+		}
+		return chars
+	}
+	for ch := range f.index {
+		chars = append(chars, ch)
+	}
+	sort.Slice(chars, func(i, j int) bool { return chars[i] < chars[j] })
+	return chars
+}
+
+// Glyph returns the bitmap of the glyph for ch, or nil if the font does not have a glyph for ch.
+// Each row of the glyph is stored in (W+7)/8 bytes, most significant bit first.
+func (f *Font) Glyph(ch rune) []byte {
+	idx, ok := f.lookup(ch)
+	if !ok {
+		return nil
+	}
+	n := f.glyphBytes()
+	return f.data[idx*n : (idx+1)*n]
+}
+
+// Monospaced returns true if all the glyphs of the font advance by the font width
+func (f *Font) Monospaced() bool {
+	return f.metrics == nil
+}
+
+func newFont(w, h int, first, last byte) *Font {
+	f := &Font{
+		W:           w,
+		H:           h,
+		FirstChar:   first,
+		LastChar:    last,
+		DefaultChar: '?',
+	}
+	f.data = make([]byte, (int(last)-int(first)+1)*f.glyphBytes())
+	return f
+}
+
+// newSparseFont creates a font with count glyphs that are looked up through a sparse glyph table
+func newSparseFont(w, h, count int) *Font {
+	f := &Font{
+		W:           w,
+		H:           h,
+		DefaultChar: '?',
+		index:       make(map[rune]int),
+	}
+	f.data = make([]byte, count*f.glyphBytes())
+	return f
+}
+
+// updateCharRange sets FirstChar and LastChar of a sparse font to the range of
+// characters in the glyph table that fall in the byte range.
+func (f *Font) updateCharRange() {
+	first, last := rune(255), rune(0)
+	for ch := range f.index {
+		if ch >= 0 && ch < first {
+			first = ch
+		}
+		if ch <= 255 && ch > last {
+			last = ch
+		}
+	}
+	if first > last {
+		first, last = 0, 0
+	}
+	f.FirstChar, f.LastChar = byte(first), byte(last)
+}
+
+const (
+	psf1Magic = 0x0436
+	psf2Magic = 0x864ab572
+
+	psf1Mode512    = 0x01
+	psf1ModeHasTab = 0x02
+	psf1ModeSeq    = 0x04
+	psf1Separator  = 0xffff
+	psf1StartSeq   = 0xfffe
+
+	psf2HasUnicodeTable = 0x01
+	psf2Separator       = 0xff
+	psf2StartSeq        = 0xfe
+)
+
+// LoadPSF loads a PC Screen Font (PSF1 or PSF2) from r.
+// If the font has a Unicode table the glyphs are looked up by the Unicode characters they represent,
+// otherwise characters map directly to the glyph positions in the font.
+func LoadPSF(r io.Reader) (*Font, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, ErrInvalidPSF
+	}
+
+	var w, h, count, size int
+	var psf2, hasTable bool
+	switch {
+	case binary.LittleEndian.Uint16(magic) == psf1Magic:
+		var hdr [4]byte
+		if _, err := io.ReadFull(br, hdr[:]); err != nil {
+			return nil, ErrInvalidPSF
+		}
+		w, h, size, count = 8, int(hdr[3]), int(hdr[3]), 256
+		if hdr[2]&psf1Mode512 != 0 {
+			count = 512
+		}
+		hasTable = hdr[2]&(psf1ModeHasTab|psf1ModeSeq) != 0
+	case binary.LittleEndian.Uint32(magic) == psf2Magic:
+		var hdr [8]uint32
+		if err := binary.Read(br, binary.LittleEndian, &hdr); err != nil {
+			return nil, ErrInvalidPSF
+		}
+		headerSize := int(hdr[2])
+		count, size, h, w = int(hdr[4]), int(hdr[5]), int(hdr[6]), int(hdr[7])
+		psf2, hasTable = true, hdr[3]&psf2HasUnicodeTable != 0
+		if headerSize < 32 {
+			return nil, ErrInvalidPSF
+		}
+		if _, err := br.Discard(headerSize - 32); err != nil {
+			return nil, ErrInvalidPSF
+		}
+	default:
+		return nil, ErrInvalidPSF
+	}
+
+	if w <= 0 || h <= 0 || count <= 0 || size != (w+7)/8*h {
+		return nil, ErrInvalidPSF
+	}
+
+	var f *Font
+	if hasTable || count > 256 {
+		f = newSparseFont(w, h, count)
+	} else {
+		f = newFont(w, h, 0, byte(count-1))
+	}
+	if _, err := io.ReadFull(br, f.data); err != nil {
+		return nil, ErrInvalidPSF
+	}
+
+	switch {
+	case hasTable && psf2:
+		err = readPSF2Table(br, f, count)
+	case hasTable:
+		err = readPSF1Table(br, f, count)
+	case count > 256:
+		for i := 0; i < count; i++ {
+			f.index[rune(i)] = i
+		}
+	}
+	if err != nil {
+		return nil, ErrInvalidPSF
+	}
+	if f.index != nil {
+		f.updateCharRange()
+	}
+	return f, nil
+}
+
+// readPSF1Table reads the Unicode table of a PSF1 font. Each glyph has a list of UCS-2 characters,
+// optionally followed by combining sequences which are skipped, terminated by 0xFFFF.
+func readPSF1Table(r io.Reader, f *Font, count int) error {
+	var ch uint16
+	for i := 0; i < count; i++ {
+		inSeq := false
+		for {
+			if err := binary.Read(r, binary.LittleEndian, &ch); err != nil {
+				return err
+			}
+			if ch == psf1Separator {
+				break
+			}
+			if ch == psf1StartSeq {
+				inSeq = true
+			}
+			if !inSeq {
+				f.index[rune(ch)] = i
+			}
+		}
+	}
+	return nil
+}
+
+// readPSF2Table reads the Unicode table of a PSF2 font. Each glyph has a list of UTF-8 characters,
+// optionally followed by combining sequences which are skipped, terminated by 0xFF.
+func readPSF2Table(r *bufio.Reader, f *Font, count int) error {
+	for i := 0; i < count; i++ {
+		entry, err := r.ReadBytes(psf2Separator)
+		if err != nil {
+			return err
+		}
+		entry = entry[:len(entry)-1]
+		if seq := bytes.IndexByte(entry, psf2StartSeq); seq >= 0 {
+			entry = entry[:seq]
+		}
+		for len(entry) > 0 {
+			ch, n := utf8.DecodeRune(entry)
+			if ch != utf8.RuneError {
+				f.index[ch] = i
+			}
+			entry = entry[n:]
+		}
+	}
+	return nil
+}
+
+type bdfGlyph struct {
+	encoding         int
+	dwidth           int
+	w, h, xoff, yoff int
+	bitmap           [][]byte
+}
+
+// LoadBDF loads a Glyph Bitmap Distribution Format (BDF) font from r.
+// Glyphs are positioned in a cell the size of the font bounding box and the glyph advance
+// and bearing are taken from the DWIDTH and bounding box of each glyph. Glyph encodings are
+// treated as Unicode characters, glyphs without an encoding are skipped.
+func LoadBDF(r io.Reader) (*Font, error) {
+	var (
+		fbbW, fbbH, fbbX, fbbY int
+		ascent                 = -1
+		defaultChar            = -1
+		monospace              = true
+		glyphs                 []*bdfGlyph
+		encoded                = make(map[int]int)
+		g                      *bdfGlyph
+		inBitmap               bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if inBitmap {
+			if fields[0] == "ENDCHAR" {
+				inBitmap = false
+				// A glyph with the encoding of an earlier glyph replaces it
+				if i, ok := encoded[g.encoding]; ok {
+					glyphs[i] = g
+				} else if g.encoding >= 0 {
+					encoded[g.encoding] = len(glyphs)
+					glyphs = append(glyphs, g)
+				}
+				g = nil
+				continue
+			}
+			row, err := hex.DecodeString(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidBDF, err)
+			}
+			g.bitmap = append(g.bitmap, row)
+			continue
+		}
+
+		var err error
+		switch fields[0] {
+		case "FONTBOUNDINGBOX":
+			fbbW, fbbH, fbbX, fbbY, err = bdfInts4(fields)
+		case "FONT_ASCENT", "DEFAULT_CHAR":
+			if len(fields) < 2 {
+				return nil, ErrInvalidBDF
+			}
+			if fields[0] == "FONT_ASCENT" {
+				ascent, err = strconv.Atoi(fields[1])
+			} else {
+				defaultChar, err = strconv.Atoi(fields[1])
+			}
+		case "STARTCHAR":
+			g = &bdfGlyph{encoding: -1, dwidth: fbbW, w: fbbW, h: fbbH, xoff: fbbX, yoff: fbbY}
+		case "ENCODING":
+			if g == nil || len(fields) < 2 {
+				return nil, ErrInvalidBDF
+			}
+			g.encoding, err = strconv.Atoi(fields[1])
+		case "DWIDTH":
+			if g == nil || len(fields) < 2 {
+				return nil, ErrInvalidBDF
+			}
+			g.dwidth, err = strconv.Atoi(fields[1])
+		case "BBX":
+			if g == nil {
+				return nil, ErrInvalidBDF
+			}
+			g.w, g.h, g.xoff, g.yoff, err = bdfInts4(fields)
+		case "BITMAP":
+			if g == nil {
+				return nil, ErrInvalidBDF
+			}
+			inBitmap = true
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBDF, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if fbbW <= 0 || fbbH <= 0 || len(glyphs) == 0 {
+		return nil, ErrInvalidBDF
+	}
+	if ascent < 0 {
+		ascent = fbbH + fbbY
+	}
+
+	first, last := math.MaxInt32, 0
+	for _, g := range glyphs {
+		if g.dwidth != fbbW || fbbX != 0 {
+			monospace = false
+		}
+		if g.encoding < first {
+			first = g.encoding
+		}
+		if g.encoding > last {
+			last = g.encoding
+		}
+	}
+
+	// Fonts beyond the byte range or with holes in the range of encodings use a sparse glyph table, so that only
+	// the glyphs of the font are found. The encodings are unique, so the range is complete when it is as long as
+	// the number of glyphs.
+	var f *Font
+	if last > 255 || last-first+1 != len(glyphs) {
+		f = newSparseFont(fbbW, fbbH, len(glyphs))
+		for i, g := range glyphs {
+			f.index[rune(g.encoding)] = i
+		}
+		f.updateCharRange()
+	} else {
+		f = newFont(fbbW, fbbH, byte(first), byte(last))
+	}
+	if defaultChar >= 0 {
+		f.DefaultChar = rune(defaultChar)
+	}
+
+	for _, g := range glyphs {
+		idx, _ := f.lookup(rune(g.encoding))
+		f.blitBDFGlyph(idx*f.glyphBytes(), g.xoff-fbbX, ascent-(g.h+g.yoff), g)
+		if !monospace {
+			f.SetGlyphMetrics(rune(g.encoding), GlyphMetrics{Advance: g.dwidth, Bearing: fbbX})
+		}
+	}
+	return f, nil
+}
+
+// blitBDFGlyph copies the bitmap of a BDF glyph into the glyph at offset in the font data,
+// with the top left of the bitmap positioned at ox, oy in the glyph cell.
+func (f *Font) blitBDFGlyph(offset, ox, oy int, g *bdfGlyph) {
+	rb := f.rowBytes()
+	for y, row := range g.bitmap {
+		cy := oy + y
+		if y >= g.h || cy < 0 || cy >= f.H {
+			continue
+		}
+		for x := 0; x < g.w; x++ {
+			cx := ox + x
+			if cx < 0 || cx >= f.W || x/8 >= len(row) {
+				continue
+			}
+			if row[x/8]&(0x80>>(x%8)) != 0 {
+				f.data[offset+cy*rb+cx/8] |= 0x80 >> (cx % 8)
+			}
+		}
+	}
+}
+
+func bdfInts4(fields []string) (a, b, c, d int, err error) {
+	if len(fields) < 5 {
+		return 0, 0, 0, 0, ErrInvalidBDF
+	}
+	var v [4]int
+	for i := range v {
+		if v[i], err = strconv.Atoi(fields[i+1]); err != nil {
+			return 0, 0, 0, 0, err
+		}
+	}
+	return v[0], v[1], v[2], v[3], nil
+}
@@ -0,0 +1,97 @@
+package gfx
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// bdfFont returns a 4x4 BDF font with a glyph for each of chars
+func bdfFont(chars ...rune) string {
+	var b strings.Builder
+	b.WriteString("STARTFONT 2.1\nFONTBOUNDINGBOX 4 4 0 0\nFONT_ASCENT 4\n")
+	for _, ch := range chars {
+		b.WriteString("STARTCHAR c\nENCODING " + strconv.Itoa(int(ch)) + "\nDWIDTH 4 0\nBBX 4 4 0 0\nBITMAP\nF0\n90\n90\nF0\nENDCHAR\n")
+	}
+	b.WriteString("ENDFONT\n")
+	return b.String()
+}
+
+func TestLoadBDFWithHoles(t *testing.T) {
+	f, err := LoadBDF(strings.NewReader(bdfFont('A', 'C')))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.HasGlyph('A') || !f.HasGlyph('C') {
+		t.Error("glyphs of the font not found")
+	}
+	if f.HasGlyph('B') {
+		t.Error("glyph found for a character missing from the font")
+	}
+	if chars := f.Chars(); len(chars) != 2 {
+		t.Errorf("Chars = %q, want the 2 characters of the font", chars)
+	}
+}
+
+func TestLoadBDFWithDuplicateEncodings(t *testing.T) {
+	// The second A fills the count of a complete range from A to C, hiding the missing B
+	src := strings.Replace(bdfFont('A', 'A', 'C'), "F0\n90\n90\nF0", "60\n60\n60\n60", 1)
+	f, err := LoadBDF(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.HasGlyph('B') {
+		t.Error("glyph found for a character missing from the font")
+	}
+	if g := f.Glyph('A'); len(g) != 4 || g[0] != 0xf0 {
+		t.Errorf("glyph A = %x, want the last glyph with the encoding", g)
+	}
+	if chars := f.Chars(); len(chars) != 2 {
+		t.Errorf("Chars = %q, want the 2 characters of the font", chars)
+	}
+}
+
+func TestLoadBDFDense(t *testing.T) {
+	f, err := LoadBDF(strings.NewReader(bdfFont('A', 'B', 'C')))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.FirstChar != 'A' || f.LastChar != 'C' || f.index != nil {
+		t.Errorf("consecutive glyphs loaded as %c..%c, sparse %v", f.FirstChar, f.LastChar, f.index != nil)
+	}
+	if g := f.Glyph('B'); len(g) != 4 || g[0] != 0xf0 || g[1] != 0x90 {
+		t.Errorf("glyph B = %x", g)
+	}
+}
+
+func TestBuiltinFontsRenderLastCharForMissingGlyphs(t *testing.T) {
+	for _, f := range []*Font{Font4x6, Font5x8, Font6x8, Font6x8Ati, Font8x8, Font8x8Bold, Font8x16} {
+		if gf, idx := f.glyph('€'); gf != f || idx != 255 {
+			t.Errorf("%dx%d font renders glyph %d for a missing character, want 255", f.W, f.H, idx)
+		}
+	}
+}
+
+func TestNewFontRejectsInvalidGlyphs(t *testing.T) {
+	tests := []struct {
+		name    string
+		w, h    int
+		chars   []rune
+		data    []byte
+		metrics []GlyphMetrics
+	}{
+		{"no glyphs", 8, 8, nil, nil, nil},
+		{"zero width", 0, 8, []rune{'a'}, make([]byte, 8), nil},
+		{"zero height", 8, 0, []rune{'a'}, make([]byte, 8), nil},
+		{"short data", 8, 8, []rune{'a', 'b'}, make([]byte, 8), nil},
+		{"short metrics", 8, 8, []rune{'a', 'b'}, make([]byte, 16), []GlyphMetrics{{Advance: 8}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewFont(tt.w, tt.h, tt.chars, tt.data, tt.metrics); err != ErrInvalidFont {
+			t.Errorf("%s: err = %v, want ErrInvalidFont", tt.name, err)
+		}
+	}
+	if _, err := NewFont(8, 8, []rune{'a', 'b'}, make([]byte, 16), nil); err != nil {
+		t.Errorf("valid font: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package gfx
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// spinTime is the time before a frame is due that the pacer stops sleeping and yields instead,
+	// because sleeps can overshoot by a few milliseconds
+	spinTime = 2 * time.Millisecond
+
+	// maxPacerLag is how far the pacer can fall behind before it stops trying to catch up on missed frames
+	maxPacerLag = 100 * time.Millisecond
+
+	// frameStatsSize is the number of frames the frame statistics are calculated over
+	frameStatsSize = 240
+)
+
+// framePacer waits for the frames to be due at a steady rate
+type framePacer struct {
+	next time.Time
+}
+
+// wait blocks until the next frame is due, a period of 0 does not wait
+func (p *framePacer) wait(period float64) {
+	if period <= 0 {
+		return
+	}
+
+	now := time.Now()
+	if p.next.IsZero() || now.Sub(p.next) > maxPacerLag {
+		p.next = now
+	}
+	p.next = p.next.Add(time.Duration(period * float64(time.Second)))
+
+	if d := time.Until(p.next) - spinTime; d > 0 {
+		time.Sleep(d)
+	}
+	for time.Now().Before(p.next) {
+		runtime.Gosched()
+	}
+}
+
+// FrameStats holds statistics of the frame times of the most recent frames, the times are in seconds
+type FrameStats struct {
+	// Frames is the number of frames the statistics are calculated over
+	Frames int
+
+	// Min, Avg and Max are the shortest, average and longest time between two frames
+	Min, Avg, Max float64
+
+	// P50, P95 and P99 are the percentiles of the time between two frames, 99% of the frames took at most P99
+	P50, P95, P99 float64
+
+	// Busy is the average time spent in a frame updating and rendering, the rest of the frame time is spent waiting
+	Busy float64
+
+	// Present is the average time from the driver starting to present a frame, including scaling it, until the
+	// display has read the pixels of the frame
+	Present float64
+}
+
+type frameStats struct {
+	times  [frameStatsSize]float64
+	busy   [frameStatsSize]float64
+	next   int
+	count  int
+	sorted []float64
+}
+
+var stats frameStats
+
+func (s *frameStats) add(frameTime, busy float64) {
+	s.times[s.next] = frameTime
+	s.busy[s.next] = busy
+	s.next = (s.next + 1) % frameStatsSize
+	if s.count < frameStatsSize {
+		s.count++
+	}
+}
+
+func (s *frameStats) calculate() FrameStats {
+	fs := FrameStats{Frames: s.count}
+	if s.count == 0 {
+		return fs
+	}
+
+	s.sorted = append(s.sorted[:0], s.times[:s.count]...)
+	sort.Float64s(s.sorted)
+	percentile := func(p float64) float64 {
+		return s.sorted[int(p*float64(s.count-1)+0.5)]
+	}
+
+	for i := 0; i < s.count; i++ {
+		fs.Avg += s.times[i]
+		fs.Busy += s.busy[i]
+	}
+	fs.Avg /= float64(s.count)
+	fs.Busy /= float64(s.count)
+	fs.Min = s.sorted[0]
+	fs.Max = s.sorted[s.count-1]
+	fs.P50 = percentile(0.50)
+	fs.P95 = percentile(0.95)
+	fs.P99 = percentile(0.99)
+	fs.Present = presents.average()
+	return fs
+}
+
+// presentStats holds the times of the most recent presents, which the driver adds from its event loop
+type presentStats struct {
+	mu    sync.Mutex
+	times [frameStatsSize]float64
+	next  int
+	count int
+}
+
+var presents presentStats
+
+func (s *presentStats) add(t float64) {
+	s.mu.Lock()
+	s.times[s.next] = t
+	s.next = (s.next + 1) % frameStatsSize
+	if s.count < frameStatsSize {
+		s.count++
+	}
+	s.mu.Unlock()
+}
+
+func (s *presentStats) average() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count == 0 {
+		return 0
+	}
+	var sum float64
+	for _, t := range s.times[:s.count] {
+		sum += t
+	}
+	return sum / float64(s.count)
+}
+
+// FrameTimeStats returns statistics of the frame times of the most recent frames
+func FrameTimeStats() FrameStats {
+	return stats.calculate()
+}
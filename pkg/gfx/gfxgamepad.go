@@ -0,0 +1,218 @@
+package gfx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxGamepads is the maximum number of gamepads that can be connected at the same time
+const MaxGamepads = 4
+
+// GamepadButton identifies a button of the standard gamepad layout. The face buttons are named
+// after their position on an Xbox style controller.
+type GamepadButton int
+
+// Gamepad buttons
+const (
+	GamepadA             GamepadButton = iota // Bottom face button
+	GamepadB                                  // Right face button
+	GamepadX                                  // Left face button
+	GamepadY                                  // Top face button
+	GamepadLeftShoulder                       // Left bumper
+	GamepadRightShoulder                      // Right bumper
+	GamepadBack                               // Back, select or share button
+	GamepadStart                              // Start or options button
+	GamepadGuide                              // Guide, home or PS button
+	GamepadLeftStick                          // Left stick pressed in
+	GamepadRightStick                         // Right stick pressed in
+	GamepadDPadUp
+	GamepadDPadDown
+	GamepadDPadLeft
+	GamepadDPadRight
+	GamepadButtonCount
+)
+
+// GamepadAxis identifies an analog axis of the standard gamepad layout
+type GamepadAxis int
+
+// Gamepad axes. The sticks range from -1 to 1, with positive values to the right and down.
+// The triggers range from 0 when released to 1 when fully pressed.
+const (
+	GamepadLeftX GamepadAxis = iota
+	GamepadLeftY
+	GamepadRightX
+	GamepadRightY
+	GamepadLeftTrigger
+	GamepadRightTrigger
+	GamepadAxisCount
+)
+
+var gamepadButtonNames = [GamepadButtonCount]string{
+	"A", "B", "X", "Y", "LeftShoulder", "RightShoulder", "Back", "Start", "Guide",
+	"LeftStick", "RightStick", "DPadUp", "DPadDown", "DPadLeft", "DPadRight",
+}
+
+var gamepadAxisNames = [GamepadAxisCount]string{
+	"LeftX", "LeftY", "RightX", "RightY", "LeftTrigger", "RightTrigger",
+}
+
+// String returns the name of the button, which is the name of the constant without the Gamepad prefix
+func (b GamepadButton) String() string {
+	if b >= 0 && b < GamepadButtonCount {
+		return gamepadButtonNames[b]
+	}
+	return fmt.Sprintf("GamepadButton(%d)", int(b))
+}
+
+// GamepadButtonByName returns the button with the specified name, ignoring case. The names are returned by GamepadButton.String.
+func GamepadButtonByName(name string) (GamepadButton, bool) {
+	for b, n := range gamepadButtonNames {
+		if strings.EqualFold(n, name) {
+			return GamepadButton(b), true
+		}
+	}
+	return 0, false
+}
+
+// String returns the name of the axis, which is the name of the constant without the Gamepad prefix
+func (a GamepadAxis) String() string {
+	if a >= 0 && a < GamepadAxisCount {
+		return gamepadAxisNames[a]
+	}
+	return fmt.Sprintf("GamepadAxis(%d)", int(a))
+}
+
+// GamepadAxisByName returns the axis with the specified name, ignoring case. The names are returned by GamepadAxis.String.
+func GamepadAxisByName(name string) (GamepadAxis, bool) {
+	for a, n := range gamepadAxisNames {
+		if strings.EqualFold(n, name) {
+			return GamepadAxis(a), true
+		}
+	}
+	return 0, false
+}
+
+type gamepadState struct {
+	connected bool
+	name      string
+	buttons   [GamepadButtonCount]keyState
+	axes      [GamepadAxisCount]float64
+}
+
+func validGamepad(pad int) bool {
+	return pad >= 0 && pad < MaxGamepads
+}
+
+// GamepadConnected returns true if a gamepad is connected in the slot pad, from 0 to MaxGamepads-1.
+// Gamepads are assigned the first free slot when they are connected.
+func GamepadConnected(pad int) bool {
+	return validGamepad(pad) && iomgr.frame.pads[pad].connected
+}
+
+// GamepadName returns the name of the gamepad reported by the device
+func GamepadName(pad int) string {
+	if !validGamepad(pad) {
+		return ""
+	}
+	return iomgr.frame.pads[pad].name
+}
+
+// GamepadButtonPressed returns true if the button of the gamepad is currently pressed
+func GamepadButtonPressed(pad int, b GamepadButton) bool {
+	return validGamepad(pad) && b >= 0 && b < GamepadButtonCount && iomgr.frame.pads[pad].buttons[b].pressed
+}
+
+// GamepadButtonJustPressed returns true if the button of the gamepad was pressed since the last update frame
+func GamepadButtonJustPressed(pad int, b GamepadButton) bool {
+	return validGamepad(pad) && b >= 0 && b < GamepadButtonCount && iomgr.frame.pads[pad].buttons[b].justPressed
+}
+
+// GamepadAxisValue returns the position of the axis of the gamepad
+func GamepadAxisValue(pad int, a GamepadAxis) float64 {
+	if !validGamepad(pad) || a < 0 || a >= GamepadAxisCount {
+		return 0
+	}
+	return iomgr.frame.pads[pad].axes[a]
+}
+
+// connectGamepad posts the connection of a gamepad and returns its slot, or -1 if all slots are in use
+// or recorded input is replayed
+func (io *ioManager) connectGamepad(name string) int {
+	io.mu.Lock()
+	defer io.mu.Unlock()
+	if io.replaying {
+		return -1
+	}
+	for pad := range io.pending.pads {
+		if !io.pending.pads[pad].connected {
+			io.post(Event{Type: EventGamepadConnected, Gamepad: pad, Name: name})
+			return pad
+		}
+	}
+	return -1
+}
+
+// disconnectGamepad posts the disconnection of a gamepad, releasing its buttons and centering its axes
+func (io *ioManager) disconnectGamepad(pad int) {
+	io.mu.Lock()
+	defer io.mu.Unlock()
+	for b := GamepadButton(0); b < GamepadButtonCount; b++ {
+		io.postGamepadButton(pad, b, false)
+	}
+	for a := GamepadAxis(0); a < GamepadAxisCount; a++ {
+		io.postGamepadAxis(pad, a, 0)
+	}
+	io.post(Event{Type: EventGamepadDisconnected, Gamepad: pad})
+}
+
+// setGamepadButton posts the state of a gamepad button if it changed
+func (io *ioManager) setGamepadButton(pad int, b GamepadButton, pressed bool) {
+	io.mu.Lock()
+	io.postGamepadButton(pad, b, pressed)
+	io.mu.Unlock()
+}
+
+func (io *ioManager) postGamepadButton(pad int, b GamepadButton, pressed bool) {
+	if io.pending.pads[pad].buttons[b].pressed == pressed {
+		return
+	}
+	ev := Event{Type: EventGamepadButtonUp, Gamepad: pad, Button: b}
+	if pressed {
+		ev.Type = EventGamepadButtonDown
+		ev.Value = 1
+	}
+	io.post(ev)
+}
+
+// setGamepadAxis posts the position of a gamepad axis if it changed
+func (io *ioManager) setGamepadAxis(pad int, a GamepadAxis, v float64) {
+	io.mu.Lock()
+	io.postGamepadAxis(pad, a, v)
+	io.mu.Unlock()
+}
+
+func (io *ioManager) postGamepadAxis(pad int, a GamepadAxis, v float64) {
+	if io.pending.pads[pad].axes[a] == v {
+		return
+	}
+	io.post(Event{Type: EventGamepadAxis, Gamepad: pad, Axis: a, Value: v})
+}
+
+// applyGamepad updates the state with a gamepad event
+func (s *inputState) applyGamepad(ev Event) {
+	p := &s.pads[ev.Gamepad]
+	switch ev.Type {
+	case EventGamepadConnected:
+		p.connected = true
+		p.name = ev.Name
+	case EventGamepadDisconnected:
+		p.connected = false
+		p.name = ""
+	case EventGamepadButtonDown:
+		p.buttons[ev.Button].set(true)
+	case EventGamepadButtonUp:
+		p.buttons[ev.Button].set(false)
+	case EventGamepadAxis:
+		p.axes[ev.Axis] = ev.Value
+	}
+}
@@ -1,155 +1,687 @@
 package gfx
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
 // Key type used to hold key codes
 type Key byte
 
 // Predefined key codes
 const (
-	KeyUndefined   = 0x00
-	KeyMouseLeft   = 0x01
-	KeyMouseRight  = 0x02
-	KeyMouseMiddle = 0x03
-	KeyBack        = 0x08
-	KeyTab         = 0x09
-	KeyClear       = 0x0C
-	KeyReturn      = 0x0D
-	KeyPause       = 0x13
-	KeyEsc         = 0x1B
-	KeySpace       = 0x20
-	KeyEnd         = 0x23
-	KeyHome        = 0x24
-	KeyLeft        = 0x25
-	KeyUp          = 0x26
-	KeyRight       = 0x27
-	KeyDown        = 0x28
-	KeyInsert      = 0x2D
-	KeyDelete      = 0x2E
-	KeyA           = 0x41
-	KeyB           = 0x42
-	KeyC           = 0x43
-	KeyD           = 0x44
-	KeyE           = 0x45
-	KeyF           = 0x46
-	KeyG           = 0x47
-	KeyH           = 0x48
-	KeyI           = 0x49
-	KeyJ           = 0x4A
-	KeyK           = 0x4B
-	KeyL           = 0x4C
-	KeyM           = 0x4D
-	KeyN           = 0x4E
-	KeyO           = 0x4F
-	KeyP           = 0x50
-	KeyQ           = 0x51
-	KeyR           = 0x52
-	KeyS           = 0x53
-	KeyT           = 0x54
-	KeyU           = 0x55
-	KeyV           = 0x56
-	KeyW           = 0x57
-	KeyX           = 0x58
-	KeyY           = 0x59
-	KeyZ           = 0x5A
-	KeyNumPad0     = 0x60
-	KeyNumPad1     = 0x61
-	KeyNumPad2     = 0x62
-	KeyNumPad3     = 0x63
-	KeyNumPad4     = 0x64
-	KeyNumPad5     = 0x65
-	KeyNumPad6     = 0x66
-	KeyNumPad7     = 0x67
-	KeyNumPad8     = 0x68
-	KeyNumPad9     = 0x69
-	KeyMultiply    = 0x6A
-	KeyAdd         = 0x6B
-	KeySeparator   = 0x6C
-	KeySubtract    = 0x6D
-	KeyDecimal     = 0x6E
-	KeyDivide      = 0x6F
-	KeyF1          = 0x70
-	KeyF2          = 0x71
-	KeyF3          = 0x72
-	KeyF4          = 0x73
-	KeyF5          = 0x74
-	KeyF6          = 0x75
-	KeyF7          = 0x76
-	KeyF8          = 0x77
-	KeyF9          = 0x78
-	KeyF10         = 0x79
-	KeyF11         = 0x7A
-	KeyF12         = 0x7B
-	KeyF13         = 0x7C
-	KeyF14         = 0x7D
-	KeyF15         = 0x7E
-	KeyF16         = 0x7F
-	KeyF17         = 0x80
-	KeyF18         = 0x81
-	KeyF19         = 0x82
-	KeyF20         = 0x83
-	KeyF21         = 0x84
-	KeyF22         = 0x85
-	KeyF23         = 0x86
-	KeyF24         = 0x87
-	KeySCROLL      = 0x91
+	KeyUndefined    = 0x00
+	KeyMouseLeft    = 0x01
+	KeyMouseRight   = 0x02
+	KeyMouseMiddle  = 0x03
+	KeyMouseBack    = 0x05
+	KeyMouseForward = 0x06
+	KeyBack         = 0x08
+	KeyTab          = 0x09
+	KeyClear        = 0x0C
+	KeyReturn       = 0x0D
+	KeyShift        = 0x10 // Either shift key
+	KeyControl      = 0x11 // Either control key
+	KeyAlt          = 0x12 // Either alt key
+	KeyPause        = 0x13
+	KeyCapsLock     = 0x14
+	KeyEsc          = 0x1B
+	KeySpace        = 0x20
+	KeyPageUp       = 0x21
+	KeyPageDown     = 0x22
+	KeyEnd          = 0x23
+	KeyHome         = 0x24
+	KeyLeft         = 0x25
+	KeyUp           = 0x26
+	KeyRight        = 0x27
+	KeyDown         = 0x28
+	KeyPrintScreen  = 0x2C
+	KeyInsert       = 0x2D
+	KeyDelete       = 0x2E
+	Key0            = 0x30
+	Key1            = 0x31
+	Key2            = 0x32
+	Key3            = 0x33
+	Key4            = 0x34
+	Key5            = 0x35
+	Key6            = 0x36
+	Key7            = 0x37
+	Key8            = 0x38
+	Key9            = 0x39
+	KeyA            = 0x41
+	KeyB            = 0x42
+	KeyC            = 0x43
+	KeyD            = 0x44
+	KeyE            = 0x45
+	KeyF            = 0x46
+	KeyG            = 0x47
+	KeyH            = 0x48
+	KeyI            = 0x49
+	KeyJ            = 0x4A
+	KeyK            = 0x4B
+	KeyL            = 0x4C
+	KeyM            = 0x4D
+	KeyN            = 0x4E
+	KeyO            = 0x4F
+	KeyP            = 0x50
+	KeyQ            = 0x51
+	KeyR            = 0x52
+	KeyS            = 0x53
+	KeyT            = 0x54
+	KeyU            = 0x55
+	KeyV            = 0x56
+	KeyW            = 0x57
+	KeyX            = 0x58
+	KeyY            = 0x59
+	KeyZ            = 0x5A
+	KeyLeftSuper    = 0x5B
+	KeyRightSuper   = 0x5C
+	KeyMenu         = 0x5D
+	KeySuper        = 0x5E // Either super (Windows) key
+	KeyNumPad0      = 0x60
+	KeyNumPad1      = 0x61
+	KeyNumPad2      = 0x62
+	KeyNumPad3      = 0x63
+	KeyNumPad4      = 0x64
+	KeyNumPad5      = 0x65
+	KeyNumPad6      = 0x66
+	KeyNumPad7      = 0x67
+	KeyNumPad8      = 0x68
+	KeyNumPad9      = 0x69
+	KeyMultiply     = 0x6A
+	KeyAdd          = 0x6B
+	KeySeparator    = 0x6C
+	KeySubtract     = 0x6D
+	KeyDecimal      = 0x6E
+	KeyDivide       = 0x6F
+	KeyF1           = 0x70
+	KeyF2           = 0x71
+	KeyF3           = 0x72
+	KeyF4           = 0x73
+	KeyF5           = 0x74
+	KeyF6           = 0x75
+	KeyF7           = 0x76
+	KeyF8           = 0x77
+	KeyF9           = 0x78
+	KeyF10          = 0x79
+	KeyF11          = 0x7A
+	KeyF12          = 0x7B
+	KeyF13          = 0x7C
+	KeyF14          = 0x7D
+	KeyF15          = 0x7E
+	KeyF16          = 0x7F
+	KeyF17          = 0x80
+	KeyF18          = 0x81
+	KeyF19          = 0x82
+	KeyF20          = 0x83
+	KeyF21          = 0x84
+	KeyF22          = 0x85
+	KeyF23          = 0x86
+	KeyF24          = 0x87
+	KeyNumLock      = 0x90
+	KeySCROLL       = 0x91
+	KeyLeftShift    = 0xA0
+	KeyRightShift   = 0xA1
+	KeyLeftControl  = 0xA2
+	KeyRightControl = 0xA3
+	KeyLeftAlt      = 0xA4
+	KeyRightAlt     = 0xA5
+	KeySemicolon    = 0xBA
+	KeyEquals       = 0xBB
+	KeyComma        = 0xBC
+	KeyMinus        = 0xBD
+	KeyPeriod       = 0xBE
+	KeySlash        = 0xBF
+	KeyGrave        = 0xC0
+	KeyLeftBracket  = 0xDB
+	KeyBackslash    = 0xDC
+	KeyRightBracket = 0xDD
+	KeyApostrophe   = 0xDE
 )
 
+// sidedKeys maps the left and right modifier keys to the key that represents either of them
+var sidedKeys = map[Key][2]Key{
+	KeyShift:   {KeyLeftShift, KeyRightShift},
+	KeyControl: {KeyLeftControl, KeyRightControl},
+	KeyAlt:     {KeyLeftAlt, KeyRightAlt},
+	KeySuper:   {KeyLeftSuper, KeyRightSuper},
+}
+
+// keyNames are the names of the predefined keys used by String and KeyByName
+var keyNames = map[Key]string{
+	KeyMouseLeft:    "MouseLeft",
+	KeyMouseRight:   "MouseRight",
+	KeyMouseMiddle:  "MouseMiddle",
+	KeyMouseBack:    "MouseBack",
+	KeyMouseForward: "MouseForward",
+	KeyBack:         "Back",
+	KeyTab:          "Tab",
+	KeyClear:        "Clear",
+	KeyReturn:       "Return",
+	KeyShift:        "Shift",
+	KeyControl:      "Control",
+	KeyAlt:          "Alt",
+	KeyPause:        "Pause",
+	KeyCapsLock:     "CapsLock",
+	KeyEsc:          "Esc",
+	KeySpace:        "Space",
+	KeyPageUp:       "PageUp",
+	KeyPageDown:     "PageDown",
+	KeyEnd:          "End",
+	KeyHome:         "Home",
+	KeyLeft:         "Left",
+	KeyUp:           "Up",
+	KeyRight:        "Right",
+	KeyDown:         "Down",
+	KeyPrintScreen:  "PrintScreen",
+	KeyInsert:       "Insert",
+	KeyDelete:       "Delete",
+	Key0:            "0",
+	Key1:            "1",
+	Key2:            "2",
+	Key3:            "3",
+	Key4:            "4",
+	Key5:            "5",
+	Key6:            "6",
+	Key7:            "7",
+	Key8:            "8",
+	Key9:            "9",
+	KeyA:            "A",
+	KeyB:            "B",
+	KeyC:            "C",
+	KeyD:            "D",
+	KeyE:            "E",
+	KeyF:            "F",
+	KeyG:            "G",
+	KeyH:            "H",
+	KeyI:            "I",
+	KeyJ:            "J",
+	KeyK:            "K",
+	KeyL:            "L",
+	KeyM:            "M",
+	KeyN:            "N",
+	KeyO:            "O",
+	KeyP:            "P",
+	KeyQ:            "Q",
+	KeyR:            "R",
+	KeyS:            "S",
+	KeyT:            "T",
+	KeyU:            "U",
+	KeyV:            "V",
+	KeyW:            "W",
+	KeyX:            "X",
+	KeyY:            "Y",
+	KeyZ:            "Z",
+	KeyLeftSuper:    "LeftSuper",
+	KeyRightSuper:   "RightSuper",
+	KeyMenu:         "Menu",
+	KeySuper:        "Super",
+	KeyNumPad0:      "NumPad0",
+	KeyNumPad1:      "NumPad1",
+	KeyNumPad2:      "NumPad2",
+	KeyNumPad3:      "NumPad3",
+	KeyNumPad4:      "NumPad4",
+	KeyNumPad5:      "NumPad5",
+	KeyNumPad6:      "NumPad6",
+	KeyNumPad7:      "NumPad7",
+	KeyNumPad8:      "NumPad8",
+	KeyNumPad9:      "NumPad9",
+	KeyMultiply:     "Multiply",
+	KeyAdd:          "Add",
+	KeySeparator:    "Separator",
+	KeySubtract:     "Subtract",
+	KeyDecimal:      "Decimal",
+	KeyDivide:       "Divide",
+	KeyF1:           "F1",
+	KeyF2:           "F2",
+	KeyF3:           "F3",
+	KeyF4:           "F4",
+	KeyF5:           "F5",
+	KeyF6:           "F6",
+	KeyF7:           "F7",
+	KeyF8:           "F8",
+	KeyF9:           "F9",
+	KeyF10:          "F10",
+	KeyF11:          "F11",
+	KeyF12:          "F12",
+	KeyF13:          "F13",
+	KeyF14:          "F14",
+	KeyF15:          "F15",
+	KeyF16:          "F16",
+	KeyF17:          "F17",
+	KeyF18:          "F18",
+	KeyF19:          "F19",
+	KeyF20:          "F20",
+	KeyF21:          "F21",
+	KeyF22:          "F22",
+	KeyF23:          "F23",
+	KeyF24:          "F24",
+	KeyNumLock:      "NumLock",
+	KeySCROLL:       "Scroll",
+	KeyLeftShift:    "LeftShift",
+	KeyRightShift:   "RightShift",
+	KeyLeftControl:  "LeftControl",
+	KeyRightControl: "RightControl",
+	KeyLeftAlt:      "LeftAlt",
+	KeyRightAlt:     "RightAlt",
+	KeySemicolon:    "Semicolon",
+	KeyEquals:       "Equals",
+	KeyComma:        "Comma",
+	KeyMinus:        "Minus",
+	KeyPeriod:       "Period",
+	KeySlash:        "Slash",
+	KeyGrave:        "Grave",
+	KeyLeftBracket:  "LeftBracket",
+	KeyBackslash:    "Backslash",
+	KeyRightBracket: "RightBracket",
+	KeyApostrophe:   "Apostrophe",
+}
+
+// String returns the name of the key, which is the name of the key constant without the Key prefix.
+// For example "Space" or "LeftShift".
+func (k Key) String() string {
+	if name, ok := keyNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("Key(0x%02X)", byte(k))
+}
+
+// KeyByName returns the key with the specified name, ignoring case. The names are returned by Key.String,
+// including the "Key(0x00)" form of the keys without a name, so every key can be saved by name and restored.
+func KeyByName(name string) (Key, bool) {
+	for k, n := range keyNames {
+		if strings.EqualFold(n, name) {
+			return k, true
+		}
+	}
+	if len(name) == 9 && strings.EqualFold(name[:6], "Key(0x") && name[8] == ')' {
+		if v, err := strconv.ParseUint(name[6:8], 16, 8); err == nil {
+			return Key(v), true
+		}
+	}
+	return KeyUndefined, false
+}
+
+// ioManager collects the events of the event loop into an input state that is handed to the update loop
+// once per update frame. The event loop only accesses the pending state and the update loop only accesses
+// the state of the current frame, so the two never share state outside of the hand off.
 type ioManager struct {
-	keymap [255]Key
+	keymap [256]Key
+
+	// mu guards the state accumulated by the event loop until it is handed to the update loop
+	mu         sync.Mutex
+	pending    inputState
+	textActive bool
+	hasMouse   bool
+	replaying  bool
+	closing    bool
+	view       viewport
+	viewScaleX float64
+	viewScaleY float64
+
+	// frame is the input state of the current update frame
+	frame inputState
+	next  int
 
-	keysPhysical [255]bool
-	keysLogical  [255]keyState
-	mouseX       float64
-	mouseY       float64
+	repeatDelay  float64
+	repeatPeriod float64
+}
+
+// inputState is the input of an update frame, including the events that produced it
+type inputState struct {
+	events []Event
+	keys   [256]keyState
+	mouseX float64
+	mouseY float64
+	wheel  [2]float64
+	delta  [2]float64
+	text   []rune
+	pads   [MaxGamepads]gamepadState
 }
 
 type keyState struct {
-	justPressed bool
-	pressed     bool
+	justPressed  bool
+	justReleased bool
+	pressed      bool
+	repeated     bool
+	held         float64
+	repeatAt     float64
+}
+
+// set updates the state for a key that is pressed or released
+func (ks *keyState) set(pressed bool) {
+	if pressed && !ks.pressed {
+		ks.justPressed = true
+	} else if !pressed && ks.pressed {
+		ks.justReleased = true
+	}
+	ks.pressed = pressed
+}
+
+// next returns the state carried over to the next frame
+func (ks keyState) next() keyState {
+	return keyState{pressed: ks.pressed, held: ks.held, repeatAt: ks.repeatAt}
+}
+
+// advance updates the time the key is held and the auto repeat of the key for a frame
+func (ks *keyState) advance(delta, repeatDelay, repeatPeriod float64) {
+	switch {
+	case ks.justPressed:
+		// A key pressed and released within the frame also reports the press as a repeat
+		ks.held = 0
+		ks.repeated = true
+		ks.repeatAt = repeatDelay
+	case !ks.pressed:
+		ks.held = 0
+	default:
+		ks.held += delta
+		// A repeat period of 0 disables the repeat
+		if repeatPeriod > 0 && ks.held >= ks.repeatAt {
+			ks.repeated = true
+			// Skip the repeats that were missed by a long frame rather than repeating on each of the next frames
+			for ks.repeatAt <= ks.held {
+				ks.repeatAt += repeatPeriod
+			}
+		}
+	}
 }
 
 func (io *ioManager) setKeyMapping(scancode byte, key Key) {
 	io.keymap[scancode] = key
 }
 
+// post adds an event to the pending input state, the caller must hold mu. The events of the platform
+// are ignored while recorded input is replayed.
+func (io *ioManager) post(ev Event) {
+	if io.replaying {
+		return
+	}
+	ev.Time = time.Now()
+	io.pending.apply(ev)
+}
+
 func (io *ioManager) setKeyPressed(key Key, state bool) {
-	io.keysPhysical[key] = state
+	io.mu.Lock()
+	io.postKey(key, state, false)
+	io.mu.Unlock()
+}
+
+// repeatKey posts a key down event generated by the auto repeat of a key that is held down
+func (io *ioManager) repeatKey(key Key) {
+	io.mu.Lock()
+	io.postKey(key, true, true)
+	io.mu.Unlock()
+}
+
+func (io *ioManager) postKey(key Key, state, repeat bool) {
+	if key == KeyUndefined {
+		return
+	}
+
+	ev := Event{Key: key, Repeat: repeat, X: io.pending.mouseX, Y: io.pending.mouseY}
+	switch {
+	case isMouseButton(key) && state:
+		ev.Type = EventMouseDown
+	case isMouseButton(key):
+		ev.Type = EventMouseUp
+	case state:
+		ev.Type = EventKeyDown
+	default:
+		ev.Type = EventKeyUp
+	}
+	io.post(ev)
 }
 
 func (io *ioManager) setMappedKeyPressed(scanCode byte, state bool) {
-	io.keysPhysical[io.keymap[scanCode]] = state
+	io.setKeyPressed(io.keymap[scanCode], state)
 }
 
+func (io *ioManager) repeatMappedKey(scanCode byte) {
+	io.repeatKey(io.keymap[scanCode])
+}
+
+// setViewport sets the area of the window a w x h surface is presented in, which maps the
+// mouse coordinates in window pixels to surface pixels
+func (io *ioManager) setViewport(v viewport, w, h int) {
+	io.mu.Lock()
+	io.view = v
+	io.viewScaleX = float64(v.w) / float64(w)
+	io.viewScaleY = float64(v.h) / float64(h)
+	io.mu.Unlock()
+}
+
+// updateMouse posts the move of the mouse to x, y in window pixels
 func (io *ioManager) updateMouse(x, y int) {
-	io.mouseX = float64(x) / scaleX
-	io.mouseY = float64(y) / scaleY
+	io.mu.Lock()
+	mx, my := float64(x-io.view.x)/io.viewScaleX, float64(y-io.view.y)/io.viewScaleY
+	ev := Event{Type: EventMouseMove, X: mx, Y: my}
+	if io.hasMouse {
+		ev.DX, ev.DY = mx-io.pending.mouseX, my-io.pending.mouseY
+	}
+	io.hasMouse = true
+	io.post(ev)
+	io.mu.Unlock()
+}
+
+// moveMouse posts the relative motion of the mouse in window pixels, without moving the mouse position
+func (io *ioManager) moveMouse(dx, dy int) {
+	io.mu.Lock()
+	io.post(Event{Type: EventMouseMove, X: io.pending.mouseX, Y: io.pending.mouseY, DX: float64(dx) / io.viewScaleX, DY: float64(dy) / io.viewScaleY})
+	io.mu.Unlock()
+}
+
+// scrollWheel posts the rotation of the mouse wheel in notches
+func (io *ioManager) scrollWheel(dx, dy float64) {
+	io.mu.Lock()
+	io.post(Event{Type: EventMouseWheel, X: io.pending.mouseX, Y: io.pending.mouseY, DX: dx, DY: dy})
+	io.mu.Unlock()
+}
+
+// addText posts a character typed while text input is active. Control characters are
+// ignored, keys like backspace and return are handled using the key state.
+func (io *ioManager) addText(ch rune) {
+	if !unicode.IsPrint(ch) {
+		return
+	}
+	io.mu.Lock()
+	if io.textActive {
+		io.post(Event{Type: EventText, Char: ch})
+	}
+	io.mu.Unlock()
+}
+
+func (io *ioManager) setReplaying(replaying bool) {
+	io.mu.Lock()
+	io.replaying = replaying
+	io.mu.Unlock()
+}
+
+func (io *ioManager) setTextInput(active bool) {
+	io.mu.Lock()
+	io.textActive = active
+	io.mu.Unlock()
+}
+
+// setFocus posts a focus change of the window. When the window loses focus the keys that are held down
+// are released, because the key up events will be delivered to another window.
+func (io *ioManager) setFocus(focused bool) {
+	io.mu.Lock()
+	if focused {
+		io.post(Event{Type: EventFocusGained})
+	} else {
+		for key, ks := range io.pending.keys {
+			if ks.pressed && !isSidedKey(Key(key)) {
+				io.postKey(Key(key), false, false)
+			}
+		}
+		io.post(Event{Type: EventFocusLost})
+	}
+	io.mu.Unlock()
+}
+
+// resize posts a change of the size of the window to w, h window pixels
+func (io *ioManager) resize(w, h int) {
+	io.mu.Lock()
+	io.post(Event{Type: EventResize, W: w, H: h})
+	io.mu.Unlock()
+}
+
+// close posts a request to close the window. The request is also noted while replaying, when the
+// event is not posted, so that the window can still be closed.
+func (io *ioManager) close() {
+	io.mu.Lock()
+	io.closing = true
+	io.post(Event{Type: EventClose})
+	io.mu.Unlock()
+}
+
+// closeRequested returns true if the window was asked to close since the last call
+func (io *ioManager) closeRequested() bool {
+	io.mu.Lock()
+	defer io.mu.Unlock()
+	closing := io.closing
+	io.closing = false
+	return closing
+}
+
+func (io *ioManager) pollEvent() (Event, bool) {
+	if io.next >= len(io.frame.events) {
+		return Event{}, false
+	}
+	io.next++
+	return io.frame.events[io.next-1], true
+}
+
+func (io *ioManager) mouseWheel() (float64, float64) {
+	return io.frame.wheel[0], io.frame.wheel[1]
+}
+
+func (io *ioManager) mouseDelta() (float64, float64) {
+	return io.frame.delta[0], io.frame.delta[1]
+}
+
+func (io *ioManager) textInput() []rune {
+	return io.frame.text
 }
 
 func (io *ioManager) keyJustPressed(key Key) bool {
-	if io.keysLogical[key].justPressed {
-		io.keysLogical[key].justPressed = false
-		return true
+	return io.frame.keys[key].justPressed
+}
+
+func (io *ioManager) keyJustReleased(key Key) bool {
+	return io.frame.keys[key].justReleased
+}
+
+func (io *ioManager) keyRepeated(key Key) bool {
+	return io.frame.keys[key].repeated
+}
+
+func (io *ioManager) keyHeldTime(key Key) float64 {
+	return io.frame.keys[key].held
+}
+
+// setKeyRepeat sets the delay and rate of the repeat, a rate of 0 disables the repeat. Negative values are ignored.
+func (io *ioManager) setKeyRepeat(delay, rate float64) {
+	if delay < 0 || rate < 0 {
+		return
+	}
+	io.repeatDelay = delay
+	io.repeatPeriod = 0
+	if rate > 0 {
+		io.repeatPeriod = 1 / rate
 	}
-	return false
 }
 
 func (io *ioManager) keyPressed(key Key) bool {
-	return io.keysLogical[key].pressed
+	return io.frame.keys[key].pressed
 }
 
 func (io *ioManager) mouseXY() (float64, float64) {
-	return io.mouseX, io.mouseY
+	return io.frame.mouseX, io.frame.mouseY
 }
 
-func (io *ioManager) update(delta float64) {
-	for i, pressed := range iomgr.keysPhysical {
-		if pressed {
-			if !io.keysLogical[i].pressed {
-				io.keysLogical[i].justPressed = true
-			}
-			io.keysLogical[i].pressed = true
-		} else {
-			io.keysLogical[i].pressed = false
-			io.keysLogical[i].justPressed = false
+// update hands the input state accumulated since the last update frame to the update loop, after applying
+// the recorded events when input is replayed. The states are double buffered, the buffers of the previous
+// frame are reused for the next pending state.
+func (io *ioManager) update(delta float64, recorded []Event) {
+	io.mu.Lock()
+	io.frame, io.pending = io.pending, io.frame
+	for _, ev := range recorded {
+		io.frame.apply(ev)
+	}
+	for i := range io.frame.keys {
+		io.frame.keys[i].advance(delta, io.repeatDelay, io.repeatPeriod)
+	}
+	io.pending.reset(&io.frame)
+	io.mu.Unlock()
+	io.next = 0
+}
+
+// reset clears the state to continue from the state of the previous frame
+func (s *inputState) reset(prev *inputState) {
+	s.events = s.events[:0]
+	s.text = s.text[:0]
+	for i, ks := range prev.keys {
+		s.keys[i] = ks.next()
+	}
+	s.mouseX, s.mouseY = prev.mouseX, prev.mouseY
+	s.wheel = [2]float64{}
+	s.delta = [2]float64{}
+	for i := range prev.pads {
+		s.pads[i] = prev.pads[i]
+		for b, bs := range prev.pads[i].buttons {
+			s.pads[i].buttons[b] = bs.next()
 		}
 	}
 }
+
+// apply updates the state with an event, so that a key that is pressed and released within a frame
+// is still reported as just pressed
+func (s *inputState) apply(ev Event) {
+	s.events = append(s.events, ev)
+	switch ev.Type {
+	case EventKeyDown, EventMouseDown:
+		if !ev.Repeat {
+			s.pressKey(ev.Key, true)
+		}
+	case EventKeyUp, EventMouseUp:
+		s.pressKey(ev.Key, false)
+	case EventMouseMove:
+		s.mouseX, s.mouseY = ev.X, ev.Y
+		s.delta[0] += ev.DX
+		s.delta[1] += ev.DY
+	case EventMouseWheel:
+		s.wheel[0] += ev.DX
+		s.wheel[1] += ev.DY
+	case EventText:
+		s.text = append(s.text, ev.Char)
+	case EventGamepadConnected, EventGamepadDisconnected, EventGamepadButtonDown, EventGamepadButtonUp, EventGamepadAxis:
+		s.applyGamepad(ev)
+	}
+}
+
+func (s *inputState) pressKey(key Key, pressed bool) {
+	s.keys[key].set(pressed)
+
+	// Keep the state of the keys that represent either of the left or right modifier keys in sync
+	for k, sides := range sidedKeys {
+		if key == sides[0] || key == sides[1] {
+			s.keys[k].set(s.keys[sides[0]].pressed || s.keys[sides[1]].pressed)
+		}
+	}
+}
+
+// isSidedKey returns true if key represents either of the left or right modifier keys
+func isSidedKey(key Key) bool {
+	_, ok := sidedKeys[key]
+	return ok
+}
+
+// isMouseButton returns true if key is one of the mouse buttons
+func isMouseButton(key Key) bool {
+	return key >= KeyMouseLeft && key <= KeyMouseForward && key != 0x04
+}
@@ -0,0 +1,48 @@
+package gfx
+
+import "testing"
+
+func TestKeyRepeatedOnPressReleasedWithinFrame(t *testing.T) {
+	io := &ioManager{}
+	io.setKeyRepeat(0.5, 10)
+	io.setKeyPressed(KeyA, true)
+	io.setKeyPressed(KeyA, false)
+	io.update(1.0/60, nil)
+	if !io.keyJustPressed(KeyA) || !io.keyJustReleased(KeyA) {
+		t.Fatal("key not reported as just pressed and released")
+	}
+	if !io.keyRepeated(KeyA) {
+		t.Error("initial press not reported as a repeat")
+	}
+}
+
+func TestKeyRepeatRate(t *testing.T) {
+	tests := []struct {
+		name        string
+		delay, rate float64
+		repeats     int
+	}{
+		{"repeat", 0.5, 8, 1 + 4},
+		{"no repeat", 0.5, 0, 1},
+		{"negative rate ignored", 0.25, -1, 1 + 4},
+		{"negative delay ignored", -1, 16, 1 + 4},
+	}
+	for _, tt := range tests {
+		io := &ioManager{}
+		io.setKeyRepeat(0.5, 8)
+		io.setKeyRepeat(tt.delay, tt.rate)
+		io.setKeyPressed(KeyA, true)
+
+		// Hold the key for 7/8 of a second after the frame it is pressed in, repeating at 0.5, 0.625, 0.75 and 0.875
+		repeats := 0
+		for frame := 0; frame < 8; frame++ {
+			io.update(0.125, nil)
+			if io.keyRepeated(KeyA) {
+				repeats++
+			}
+		}
+		if repeats != tt.repeats {
+			t.Errorf("%s: %d repeats, want %d", tt.name, repeats, tt.repeats)
+		}
+	}
+}
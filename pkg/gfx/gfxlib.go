@@ -7,6 +7,7 @@ import (
 	_ "image/png"  // imported to register the png image decoder used to load textures from image files of this type
 	"math"
 	"os"
+	"strings"
 )
 
 // Texture in memory representation of a texture
@@ -365,44 +366,46 @@ func FillEllipse(x, y, rx, ry float64, c Color) {
 
 // DrawChar renders a character using the specified font. A Transparent color can be used for the background.
 func DrawChar(font *Font, x, y float64, ch byte, bk, fg Color) {
-	ix := int(x + 0.5)
-	iy := int(y + 0.5)
+	DrawRune(font, x, y, rune(ch), bk, fg)
+}
 
-	if ch < font.FirstChar {
-		ch = font.FirstChar
-	}
-	if ch > font.LastChar {
-		ch = font.LastChar
-	}
+// DrawRune renders a Unicode character using the specified font. A Transparent color can be used for the background.
+// If the font does not have a glyph for the character the fallback fonts are searched before falling back to the
+// default character of the font.
+func DrawRune(font *Font, x, y float64, ch rune, bk, fg Color) {
+	gf, idx := font.glyph(ch)
+	drawGlyph(gf, idx, int(x+0.5), int(y+0.5), false, bk, fg)
+}
 
-	firstByte := (int(ch) - int(font.FirstChar)) * font.H
-	for i := 0; i < font.H; i++ {
-		b := font.data[firstByte+i]
-		for j := 0; j < font.W; j++ {
-			if b&0x80 != 0 {
-				driver.SetPixel(ix+j, iy+i, fg)
-			} else if bk != Transparent {
-				driver.SetPixel(ix+j, iy+i, bk)
-			}
-			b <<= 1
-		}
+// drawGlyph renders a glyph with the top left of its cell at ix, iy, filling the cell with bk first unless it is
+// Transparent. A bold glyph is widened by a pixel to the right, like drawing it twice one pixel apart.
+func drawGlyph(font *Font, glyph, ix, iy int, bold bool, bk, fg Color) {
+	if bk != Transparent {
+		driver.FillRect(ix, iy, font.W, font.H, bk)
+	}
+	extra := 0
+	if bold {
+		extra = 1
 	}
+	glyphRuns(font, glyph, ix, iy, 1, 1, func(x, y, w, h int) {
+		driver.FillRect(x, y, w+extra, h, fg)
+	})
 }
 
-// DrawString renders a string using the specified font. The background color can be Transparent
-func DrawString(font *Font, x, y float64, str string, bk, fg Color) {
-	ix := int(x + 0.5)
-	iy := int(y + 0.5)
-	fw := float64(font.W)
-	sw := width
-	if x > width || y > height || ix+len(str)*font.W < 0 || iy+font.H < 0 {
+// DrawString renders a string using the specified font. The background color can be Transparent.
+// Characters are positioned using the glyph metrics and kerning of the font, new line characters
+// start a new line and tab characters advance to the next tab stop.
+func DrawString(font *Font, x, y float64, str string, bk, fg Color, opts ...TextOption) {
+	if x > width || y > height {
 		return
 	}
-	for _, ch := range str {
-		DrawChar(font, x, y, byte(ch), bk, fg)
-		x += fw
-		if x > sw {
-			break
-		}
+	if len(opts) == 0 && strings.IndexByte(str, '\n') < 0 {
+		// A single line without options is drawn without allocating a layout
+		l := TextLayout{font: font, opts: textOptions{sx: 1, sy: 1, tabWidth: defaultTabWidth(font)}}
+		ln := textLine{text: str}
+		ln.w = l.measure(str)
+		l.drawLine(ln, x, y, bk, fg)
+		return
 	}
+	LayoutText(font, 0, 0, str, opts...).Draw(x, y, bk, fg)
 }
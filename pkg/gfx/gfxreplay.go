@@ -0,0 +1,128 @@
+package gfx
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrInvalidRecording is returned when recorded input cannot be replayed
+var ErrInvalidRecording = errors.New("gfx: invalid input recording")
+
+const recordingVersion = 1
+
+type recordingHeader struct {
+	Version       int
+	Width, Height float64
+}
+
+// recordedFrame is the input of an update frame and the delta time passed to Update
+type recordedFrame struct {
+	Delta  float64
+	Events []Event
+}
+
+type inputRecorder struct {
+	enc *gob.Encoder
+	err error
+}
+
+type inputPlayer struct {
+	dec *gob.Decoder
+	err error
+}
+
+var (
+	recorder  *inputRecorder
+	player    *inputPlayer
+	replayErr error
+)
+
+// RecordInput starts recording the input events and the delta time of every update frame to w, until
+// StopRecording is called. The recording can be replayed with ReplayInput to reproduce a session.
+// RecordInput must be called from Load or Update.
+func RecordInput(w io.Writer) error {
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(recordingHeader{Version: recordingVersion, Width: width, Height: height}); err != nil {
+		return err
+	}
+	recorder = &inputRecorder{enc: enc}
+	return nil
+}
+
+// StopRecording stops recording input and returns the first error that occurred while writing the recording
+func StopRecording() error {
+	if recorder == nil {
+		return nil
+	}
+	err := recorder.err
+	recorder = nil
+	return err
+}
+
+// ReplayInput starts replaying input recorded by RecordInput from r. While replaying, the input of the platform
+// is ignored and Update receives the recorded delta times, so that an application that only depends on its input
+// and the delta times behaves exactly as it did during the recording. With the headless driver, selected with the
+// headless build tag, the application ends when the replay finishes. ReplayInput must be called from Load or Update.
+func ReplayInput(r io.Reader) error {
+	dec := gob.NewDecoder(r)
+	var h recordingHeader
+	if err := dec.Decode(&h); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRecording, err)
+	}
+	if h.Version != recordingVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidRecording, h.Version)
+	}
+	if h.Width != width || h.Height != height {
+		return fmt.Errorf("%w: recorded at %vx%v", ErrInvalidRecording, h.Width, h.Height)
+	}
+	player = &inputPlayer{dec: dec}
+	replayErr = nil
+	iomgr.setReplaying(true)
+	return nil
+}
+
+// Replaying returns true while recorded input is replayed
+func Replaying() bool {
+	return player != nil
+}
+
+// StopReplay stops replaying input and returns the error that ended the replay if the recording could not be read
+// to the end. When the replay already finished, StopReplay only returns the error.
+func StopReplay() error {
+	finishReplay()
+	err := replayErr
+	replayErr = nil
+	return err
+}
+
+// finishReplay ends the replay, keeping the error that ended it for StopReplay
+func finishReplay() {
+	if player != nil {
+		replayErr = player.err
+		player = nil
+		iomgr.setReplaying(false)
+	}
+}
+
+// record writes the input of an update frame
+func (r *inputRecorder) record(delta float64, events []Event) {
+	if r.err == nil {
+		r.err = r.enc.Encode(recordedFrame{Delta: delta, Events: events})
+	}
+}
+
+// next reads the input of the next update frame, ok is false when the recording ended
+func (p *inputPlayer) next() (frame recordedFrame, ok bool) {
+	if p.err != nil {
+		return frame, false
+	}
+	if err := p.dec.Decode(&frame); err != nil {
+		if err != io.EOF {
+			p.err = fmt.Errorf("%w: %v", ErrInvalidRecording, err)
+		}
+		return frame, false
+	}
+	return frame, true
+}
@@ -0,0 +1,155 @@
+//go:build headless
+// +build headless
+
+package gfx
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// inputSnapshot is the input state an application observes in an update frame
+type inputSnapshot struct {
+	Delta                          float64
+	Pressed, JustPressed, Released bool
+	Repeated                       bool
+	Held                           float64
+	MouseX, MouseY                 float64
+	WheelX, WheelY, MoveDX, MoveDY float64
+	Text                           string
+	Events                         []Event
+}
+
+// scriptedInput posts the input of the script as the event loop of a driver would, the input posted in a frame
+// is seen by the next frame
+var scriptedInput = map[int]func(){
+	1: func() { iomgr.setKeyPressed(KeyA, true) },
+	2: func() { iomgr.repeatKey(KeyA) },
+	3: func() {
+		iomgr.updateMouse(10, 20)
+		iomgr.scrollWheel(0, -1)
+	},
+	4: func() {
+		iomgr.setKeyPressed(KeyA, false)
+		iomgr.setTextInput(true)
+		iomgr.addText('x')
+	},
+	5: func() {
+		iomgr.setKeyPressed(KeyA, true)
+		iomgr.setKeyPressed(KeyA, false)
+		iomgr.updateMouse(15, 18)
+	},
+}
+
+const scriptFrames = 8
+
+// replayApp records the input state of every frame, it posts the scripted input and records it to rec, or replays
+// the input from play
+type replayApp struct {
+	t      *testing.T
+	rec    *bytes.Buffer
+	play   *bytes.Buffer
+	frame  int
+	frames []inputSnapshot
+}
+
+func (a *replayApp) Load() {
+	var err error
+	if a.play != nil {
+		err = ReplayInput(a.play)
+	} else {
+		err = RecordInput(a.rec)
+	}
+	if err != nil {
+		a.t.Fatal(err)
+	}
+}
+
+func (a *replayApp) Update(d float64) {
+	mx, my := MouseXY()
+	wx, wy := MouseWheel()
+	dx, dy := MouseDelta()
+	s := inputSnapshot{
+		Delta:       d,
+		Pressed:     KeyPressed(KeyA),
+		JustPressed: KeyJustPressed(KeyA),
+		Released:    KeyJustReleased(KeyA),
+		Repeated:    KeyRepeated(KeyA),
+		Held:        KeyHeldTime(KeyA),
+		MouseX:      mx, MouseY: my,
+		WheelX: wx, WheelY: wy, MoveDX: dx, MoveDY: dy,
+		Text: string(TextInput()),
+	}
+	for {
+		ev, ok := PollEvent()
+		if !ok {
+			break
+		}
+		// The time the event was posted is not recorded
+		ev.Time = ev.Time.UTC().Round(0)
+		s.Events = append(s.Events, ev)
+	}
+	a.frames = append(a.frames, s)
+
+	a.frame++
+	if a.play != nil {
+		return
+	}
+	if post, ok := scriptedInput[a.frame]; ok {
+		post()
+	}
+	if a.frame == scriptFrames {
+		if err := StopRecording(); err != nil {
+			a.t.Error(err)
+		}
+		Quit()
+	}
+}
+
+func (a *replayApp) Unload() {
+}
+
+func runReplayApp(t *testing.T, a *replayApp) {
+	t.Helper()
+	if err := InitWithConfig(Config{Width: 64, Height: 48}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run(a); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordReplayRoundTrip(t *testing.T) {
+	var recording bytes.Buffer
+	recorded := &replayApp{t: t, rec: &recording}
+	runReplayApp(t, recorded)
+	if len(recorded.frames) != scriptFrames {
+		t.Fatalf("recorded %d frames, want %d", len(recorded.frames), scriptFrames)
+	}
+
+	replayed := &replayApp{t: t, play: &recording}
+	runReplayApp(t, replayed)
+	if err := StopReplay(); err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed.frames) != len(recorded.frames) {
+		t.Fatalf("replayed %d frames, recorded %d", len(replayed.frames), len(recorded.frames))
+	}
+	for i := range recorded.frames {
+		if !reflect.DeepEqual(replayed.frames[i], recorded.frames[i]) {
+			t.Errorf("frame %d replayed as\n\t%+v\nrecorded as\n\t%+v", i, replayed.frames[i], recorded.frames[i])
+		}
+	}
+
+	// The script reached the application, the frames are not trivially equal
+	if f := recorded.frames[1]; !f.Pressed || !f.JustPressed {
+		t.Errorf("frame 1 = %+v, want KeyA just pressed", f)
+	}
+	if f := recorded.frames[3]; f.MouseX != 10 || f.MouseY != 20 || f.WheelY != -1 {
+		t.Errorf("frame 3 = %+v, want the mouse at 10, 20 and the wheel scrolled", f)
+	}
+	if f := recorded.frames[4]; !f.Released || f.Text != "x" {
+		t.Errorf("frame 4 = %+v, want KeyA released and the text x", f)
+	}
+}
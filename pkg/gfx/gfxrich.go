@@ -0,0 +1,319 @@
+package gfx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidMarkup is returned when rich text markup cannot be parsed
+var ErrInvalidMarkup = errors.New("gfx: invalid markup")
+
+// builtinFonts are the fonts that can be selected by name in rich text markup
+var builtinFonts = map[string]*Font{
+	"4x6":     Font4x6,
+	"5x8":     Font5x8,
+	"6x8":     Font6x8,
+	"6x8ati":  Font6x8Ati,
+	"8x8":     Font8x8,
+	"8x8bold": Font8x8Bold,
+	"8x16":    Font8x16,
+}
+
+// RichTextOption is the signature of a configuration function for rich text
+type RichTextOption func(o *richTextOptions)
+
+type richTextOptions struct {
+	bk, fg Color
+	fonts  map[string]*Font
+	icons  map[string]*Texture
+}
+
+// RichColors is a RichTextOption function that sets the background and foreground colors used for text
+// that is not inside a color tag. The default is a Transparent background with White text.
+func RichColors(bk, fg Color) RichTextOption {
+	return func(o *richTextOptions) {
+		o.bk = bk
+		o.fg = fg
+	}
+}
+
+// RichFont is a RichTextOption function that makes a font available to the [f=name] tag.
+// The built-in fonts are available as 4x6, 5x8, 6x8, 6x8ati, 8x8, 8x8bold and 8x16.
+func RichFont(name string, f *Font) RichTextOption {
+	return func(o *richTextOptions) {
+		o.fonts[name] = f
+	}
+}
+
+// RichIcon is a RichTextOption function that makes a texture available to the [img=name] tag
+func RichIcon(name string, t *Texture) RichTextOption {
+	return func(o *richTextOptions) {
+		o.icons[name] = t
+	}
+}
+
+// RichText is a string with inline markup parsed into styled runs of text, ready to be rendered.
+// Parsing the markup once and reusing the RichText avoids repeating the work every frame.
+//
+// The following tags are supported
+//
+//	[c=color]...[/c]    foreground color, either a predefined color name like yellow or #rrggbb
+//	[bg=color]...[/bg]  background color
+//	[b]...[/b]          bold text
+//	[f=font]...[/f]     switch font
+//	[img=icon]          inline icon texture
+//
+// A literal [ is written as [[ and new line characters start a new line.
+type RichText struct {
+	lines []richLine
+	w, h  int
+}
+
+type richLine struct {
+	runs []richRun
+	w, h int
+}
+
+type richRun struct {
+	text   string
+	font   *Font
+	bk, fg Color
+	bold   bool
+	icon   *Texture
+	w, h   int
+}
+
+type richStyle struct {
+	font   []*Font
+	bk, fg []Color
+	bold   int
+}
+
+// NewRichText parses markup into a RichText using font for text that is not inside a font tag
+func NewRichText(font *Font, markup string, opts ...RichTextOption) (*RichText, error) {
+	o := &richTextOptions{
+		bk:    Transparent,
+		fg:    White,
+		fonts: make(map[string]*Font),
+		icons: make(map[string]*Texture),
+	}
+	for name, f := range builtinFonts {
+		o.fonts[name] = f
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	rt := &RichText{}
+	style := &richStyle{
+		font: []*Font{font},
+		bk:   []Color{o.bk},
+		fg:   []Color{o.fg},
+	}
+	line := richLine{}
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			line.add(style.run(text.String()))
+			text.Reset()
+		}
+	}
+
+	for len(markup) > 0 {
+		ch := markup[0]
+		switch {
+		case ch == '\n':
+			flush()
+			rt.addLine(line, font)
+			line = richLine{}
+			markup = markup[1:]
+		case strings.HasPrefix(markup, "[["):
+			text.WriteByte('[')
+			markup = markup[2:]
+		case ch == '[':
+			end := strings.IndexByte(markup, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated tag %q", ErrInvalidMarkup, markup)
+			}
+			flush()
+			icon, err := style.apply(markup[1:end], o)
+			if err != nil {
+				return nil, err
+			}
+			if icon != nil {
+				line.add(richRun{icon: icon, w: icon.W, h: icon.H, bk: style.bk[len(style.bk)-1]})
+			}
+			markup = markup[end+1:]
+		default:
+			text.WriteByte(ch)
+			markup = markup[1:]
+		}
+	}
+	flush()
+	rt.addLine(line, font)
+	return rt, nil
+}
+
+// apply updates the style for a tag, returning the texture of icon tags
+func (s *richStyle) apply(tag string, o *richTextOptions) (*Texture, error) {
+	name, value := tag, ""
+	if i := strings.IndexByte(tag, '='); i >= 0 {
+		name, value = tag[:i], tag[i+1:]
+	}
+
+	pop := func(n int) error {
+		if n <= 1 {
+			return fmt.Errorf("%w: unmatched [%s]", ErrInvalidMarkup, tag)
+		}
+		return nil
+	}
+
+	switch name {
+	case "c", "bg":
+		c, ok := ColorByName(value)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown color %q", ErrInvalidMarkup, value)
+		}
+		if name == "c" {
+			s.fg = append(s.fg, c)
+		} else {
+			s.bk = append(s.bk, c)
+		}
+	case "/c":
+		if err := pop(len(s.fg)); err != nil {
+			return nil, err
+		}
+		s.fg = s.fg[:len(s.fg)-1]
+	case "/bg":
+		if err := pop(len(s.bk)); err != nil {
+			return nil, err
+		}
+		s.bk = s.bk[:len(s.bk)-1]
+	case "b":
+		s.bold++
+	case "/b":
+		if err := pop(s.bold + 1); err != nil {
+			return nil, err
+		}
+		s.bold--
+	case "f":
+		f, ok := o.fonts[value]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown font %q", ErrInvalidMarkup, value)
+		}
+		s.font = append(s.font, f)
+	case "/f":
+		if err := pop(len(s.font)); err != nil {
+			return nil, err
+		}
+		s.font = s.font[:len(s.font)-1]
+	case "img":
+		t, ok := o.icons[value]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown icon %q", ErrInvalidMarkup, value)
+		}
+		return t, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown tag [%s]", ErrInvalidMarkup, tag)
+	}
+	return nil, nil
+}
+
+// run creates a run of text using the current style
+func (s *richStyle) run(text string) richRun {
+	r := richRun{
+		text: text,
+		font: s.font[len(s.font)-1],
+		bk:   s.bk[len(s.bk)-1],
+		fg:   s.fg[len(s.fg)-1],
+		bold: s.bold > 0,
+	}
+	var prev rune = -1
+	for _, ch := range text {
+		if prev >= 0 {
+			r.w += r.font.Kerning(prev, ch)
+		}
+		r.w += r.font.GlyphMetrics(ch).Advance
+		if r.bold {
+			r.w++
+		}
+		prev = ch
+	}
+	r.h = r.font.H
+	return r
+}
+
+func (l *richLine) add(r richRun) {
+	l.runs = append(l.runs, r)
+	l.w += r.w
+	if r.h > l.h {
+		l.h = r.h
+	}
+}
+
+func (rt *RichText) addLine(l richLine, font *Font) {
+	if l.h == 0 {
+		l.h = font.H
+	}
+	rt.lines = append(rt.lines, l)
+	rt.h += l.h
+	if l.w > rt.w {
+		rt.w = l.w
+	}
+}
+
+// Size returns the size of the area covered by the text
+func (rt *RichText) Size() (w, h float64) {
+	return float64(rt.w), float64(rt.h)
+}
+
+// Draw renders the text with the top left at x, y. Runs of different heights on a line are aligned at the bottom of the line.
+func (rt *RichText) Draw(x, y float64) {
+	ly := y
+	for _, l := range rt.lines {
+		if ly > height {
+			break
+		}
+		px := x
+		for _, r := range l.runs {
+			ry := ly + float64(l.h-r.h)
+			if r.bk != Transparent {
+				FillRect(px, ry, float64(r.w), float64(r.h), r.bk)
+			}
+			if r.icon != nil {
+				DrawTexture(px, ry, r.icon)
+				px += float64(r.w)
+				continue
+			}
+			var prev rune = -1
+			for _, ch := range r.text {
+				if prev >= 0 {
+					px += float64(r.font.Kerning(prev, ch))
+				}
+				m := r.font.GlyphMetrics(ch)
+				gf, idx := r.font.glyph(ch)
+				drawGlyph(gf, idx, int(px+float64(m.Bearing)+0.5), int(ry+0.5), r.bold, Transparent, r.fg)
+				if r.bold {
+					px++
+				}
+				px += float64(m.Advance)
+				prev = ch
+			}
+		}
+		ly += float64(l.h)
+	}
+}
+
+// DrawRichString parses markup and renders it with the top left at x, y. See RichText for the supported tags.
+// If the markup cannot be parsed it is rendered as plain text. Use NewRichText to parse the markup once
+// when the same text is rendered repeatedly.
+func DrawRichString(font *Font, x, y float64, markup string, opts ...RichTextOption) {
+	rt, err := NewRichText(font, markup, opts...)
+	if err != nil {
+		DrawString(font, x, y, markup, Transparent, White)
+		return
+	}
+	rt.Draw(x, y)
+}
@@ -0,0 +1,508 @@
+package gfx
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// Alignment specifies how the lines of a text layout are aligned horizontally
+type Alignment int
+
+// Text alignments
+const (
+	AlignLeft Alignment = iota
+	AlignCenter
+	AlignRight
+	AlignJustify
+)
+
+const (
+	defaultTabSize = 4
+	ellipsis       = "..."
+)
+
+// TextOption is the signature of a configuration function for text layout and rendering
+type TextOption func(o *textOptions)
+
+type textOptions struct {
+	align       Alignment
+	wrap        bool
+	ellipsis    bool
+	lineSpacing int
+	tabWidth    int
+
+	sx, sy       float64
+	shadow       bool
+	shadowDx     int
+	shadowDy     int
+	shadowColor  Color
+	outline      bool
+	outlineColor Color
+	gradient     bool
+	gradientTo   Color
+}
+
+// Align is a TextOption function that sets the horizontal alignment of the lines of text
+func Align(a Alignment) TextOption {
+	return func(o *textOptions) {
+		o.align = a
+	}
+}
+
+// WordWrap is a TextOption function that breaks lines between words to fit the width of the layout box.
+// Words that are wider than the box are broken between characters.
+func WordWrap() TextOption {
+	return func(o *textOptions) {
+		o.wrap = true
+	}
+}
+
+// Ellipsis is a TextOption function that truncates text that does not fit in the layout box and
+// terminates it with an ellipsis.
+func Ellipsis() TextOption {
+	return func(o *textOptions) {
+		o.ellipsis = true
+	}
+}
+
+// LineSpacing is a TextOption function that sets the number of font pixels added between lines
+func LineSpacing(px int) TextOption {
+	return func(o *textOptions) {
+		o.lineSpacing = px
+	}
+}
+
+// TabStops is a TextOption function that sets the distance in font pixels between tab stops.
+// The default is four times the width of the font.
+func TabStops(px int) TextOption {
+	return func(o *textOptions) {
+		o.tabWidth = px
+	}
+}
+
+// TextScale is a TextOption function that scales the rendered text. Fractional scales are supported,
+// the pixels of the font are distributed over the scaled cell using nearest neighbour sampling.
+func TextScale(sx, sy float64) TextOption {
+	return func(o *textOptions) {
+		o.sx = sx
+		o.sy = sy
+	}
+}
+
+// TextShadow is a TextOption function that renders a drop shadow of the text offset by dx, dy pixels.
+// The shadow is not included in the size of the layout.
+func TextShadow(dx, dy int, c Color) TextOption {
+	return func(o *textOptions) {
+		o.shadow = true
+		o.shadowDx = dx
+		o.shadowDy = dy
+		o.shadowColor = c
+	}
+}
+
+// TextOutline is a TextOption function that renders a 1 pixel outline around the text.
+// The outline is not included in the size of the layout.
+func TextOutline(c Color) TextOption {
+	return func(o *textOptions) {
+		o.outline = true
+		o.outlineColor = c
+	}
+}
+
+// TextGradient is a TextOption function that colors the characters of each line with a gradient
+// starting with the foreground color and ending with the color to.
+func TextGradient(to Color) TextOption {
+	return func(o *textOptions) {
+		o.gradient = true
+		o.gradientTo = to
+	}
+}
+
+// TextLayout holds a string broken into lines and positioned in a box, ready to be rendered.
+// A layout can be reused to render the same text multiple times without repeating the measurement.
+type TextLayout struct {
+	font  *Font
+	opts  textOptions
+	lines []textLine
+	w, h  int
+
+	// mask holds the pixels of a line when drawing its outline, it is kept to be reused by the next line
+	mask []bool
+}
+
+type textLine struct {
+	text    string
+	x, y, w int
+	// gap is the extra space added to each space character of justified lines
+	gap float64
+}
+
+// LayoutText breaks str into lines that fit a box of w by h pixels. A width or height of 0
+// does not constrain the layout in that direction.
+func LayoutText(font *Font, w, h float64, str string, opts ...TextOption) *TextLayout {
+	l := &TextLayout{font: font, opts: textOptions{sx: 1, sy: 1}}
+	for _, opt := range opts {
+		opt(&l.opts)
+	}
+	if l.opts.tabWidth <= 0 {
+		l.opts.tabWidth = defaultTabWidth(font)
+	}
+	if l.opts.sx <= 0 || l.opts.sy <= 0 {
+		l.opts.sx, l.opts.sy = 1, 1
+	}
+
+	// The layout is calculated in unscaled font pixels
+	bw := int(w/l.opts.sx + 0.5)
+	bh := int(h/l.opts.sy + 0.5)
+
+	var lines []textLine
+	for _, para := range strings.Split(str, "\n") {
+		if l.opts.wrap && bw > 0 {
+			lines = append(lines, l.wrap(para, bw)...)
+		} else {
+			lines = append(lines, textLine{text: para, gap: -1})
+		}
+	}
+
+	lineHeight := font.H + l.opts.lineSpacing
+	if bh > 0 {
+		maxLines := (bh + l.opts.lineSpacing) / lineHeight
+		if maxLines < len(lines) {
+			lines = lines[:maxLines]
+			if l.opts.ellipsis && maxLines > 0 {
+				last := &lines[maxLines-1]
+				last.text = l.truncate(last.text+ellipsis, bw)
+			}
+		}
+	}
+
+	for i := range lines {
+		ln := &lines[i]
+		if l.opts.ellipsis && bw > 0 {
+			ln.text = l.truncate(ln.text, bw)
+		}
+		ln.w = l.measure(ln.text)
+		if ln.w > l.w {
+			l.w = ln.w
+		}
+	}
+
+	boxW := bw
+	if boxW == 0 {
+		boxW = l.w
+	}
+	for i := range lines {
+		ln := &lines[i]
+		ln.y = i * lineHeight
+		switch l.opts.align {
+		case AlignCenter:
+			ln.x = (boxW - ln.w) / 2
+		case AlignRight:
+			ln.x = boxW - ln.w
+		case AlignJustify:
+			// The last line of a paragraph is not justified
+			if ln.gap >= 0 {
+				if spaces := strings.Count(ln.text, " "); spaces > 0 && ln.w < boxW {
+					ln.gap = float64(boxW-ln.w) / float64(spaces)
+					ln.w = boxW
+				}
+			}
+		}
+		if ln.gap < 0 {
+			ln.gap = 0
+		}
+	}
+
+	l.lines = lines
+	if len(lines) > 0 {
+		l.h = len(lines)*lineHeight - l.opts.lineSpacing
+	}
+	return l
+}
+
+// defaultTabWidth returns the distance between the default tab stops of font, which is never 0 so that fonts
+// without a width can be measured
+func defaultTabWidth(font *Font) int {
+	if font.W <= 0 {
+		return defaultTabSize
+	}
+	return defaultTabSize * font.W
+}
+
+// wrap breaks a paragraph into lines that fit w pixels. Every line except the last
+// is marked as a candidate for justification.
+func (l *TextLayout) wrap(para string, w int) []textLine {
+	var lines []textLine
+	line := ""
+	for _, word := range strings.Split(para, " ") {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if l.measure(candidate) <= w {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, textLine{text: line})
+		}
+		// Break words that do not fit on a line of their own
+		for l.measure(word) > w && utf8.RuneCountInString(word) > 1 {
+			n := l.fit(word, w)
+			lines = append(lines, textLine{text: word[:n]})
+			word = word[n:]
+		}
+		line = word
+	}
+	return append(lines, textLine{text: line, gap: -1})
+}
+
+// fit returns the length in bytes of the longest prefix of str that fits w pixels. At least one character is always returned.
+func (l *TextLayout) fit(str string, w int) int {
+	n := 0
+	for i, ch := range str {
+		end := i + utf8.RuneLen(ch)
+		if n > 0 && l.measure(str[:end]) > w {
+			break
+		}
+		n = end
+	}
+	return n
+}
+
+// truncate shortens str to fit w pixels, terminating it with an ellipsis when characters are removed. When the
+// ellipsis does not fit on its own it is clipped as well.
+func (l *TextLayout) truncate(str string, w int) string {
+	if w <= 0 || l.measure(str) <= w {
+		return str
+	}
+	str = strings.TrimSuffix(str, ellipsis)
+	for len(str) > 0 {
+		_, n := utf8.DecodeLastRuneInString(str)
+		str = str[:len(str)-n]
+		if l.measure(str+ellipsis) <= w {
+			break
+		}
+	}
+	e := ellipsis
+	for len(e) > 0 && l.measure(str+e) > w {
+		e = e[:len(e)-1]
+	}
+	return str + e
+}
+
+// measure returns the width in pixels of a single line of text
+func (l *TextLayout) measure(str string) int {
+	x := 0
+	var prev rune = -1
+	for _, ch := range str {
+		if ch == '\t' {
+			x = (x/l.opts.tabWidth + 1) * l.opts.tabWidth
+			prev = -1
+			continue
+		}
+		if prev >= 0 {
+			x += l.font.Kerning(prev, ch)
+		}
+		x += l.font.GlyphMetrics(ch).Advance
+		prev = ch
+	}
+	return x
+}
+
+// Size returns the size of the area covered by the text
+func (l *TextLayout) Size() (w, h float64) {
+	return float64(l.w) * l.opts.sx, float64(l.h) * l.opts.sy
+}
+
+// LineCount returns the number of lines in the layout
+func (l *TextLayout) LineCount() int {
+	return len(l.lines)
+}
+
+// Draw renders the text with the top left of the layout box at x, y. The background color can be Transparent.
+func (l *TextLayout) Draw(x, y float64, bk, fg Color) {
+	for _, ln := range l.lines {
+		ly := y + float64(ln.y)*l.opts.sy
+		if ly > height {
+			break
+		}
+		l.drawLine(ln, x+float64(ln.x)*l.opts.sx, ly, bk, fg)
+	}
+}
+
+// drawLine renders a line of the layout with the top left of the line at x, y
+func (l *TextLayout) drawLine(ln textLine, x, y float64, bk, fg Color) {
+	o := &l.opts
+	font := l.font
+	if y+float64(font.H)*o.sy < 0 {
+		return
+	}
+	if bk != Transparent {
+		FillRect(x, y, float64(ln.w)*o.sx, float64(font.H)*o.sy, bk)
+	}
+
+	// Shadows and outlines are rendered for the whole line before the text, so that they
+	// do not overlap the neighbouring characters
+	if o.shadow {
+		l.drawChars(ln, x+float64(o.shadowDx), y+float64(o.shadowDy), func(int) Color { return o.shadowColor })
+	}
+	if o.outline {
+		l.drawOutline(ln, x, y, o.outlineColor)
+	}
+
+	if o.gradient {
+		n := utf8.RuneCountInString(ln.text) - 1
+		l.drawChars(ln, x, y, func(i int) Color {
+			if n <= 0 {
+				return fg
+			}
+			return fg.Lerp(o.gradientTo, float64(i)/float64(n))
+		})
+	} else {
+		l.drawChars(ln, x, y, func(int) Color { return fg })
+	}
+}
+
+// drawChars renders the characters of a line with the top left of the line at x, y. The color of each
+// character is selected by calling color with the index of the character in the line.
+func (l *TextLayout) drawChars(ln textLine, x, y float64, color func(i int) Color) {
+	o := &l.opts
+	l.glyphs(ln, x, func(gf *Font, idx int, gx float64, i int) {
+		c := color(i)
+		glyphRuns(gf, idx, int(gx+0.5), int(y+0.5), o.sx, o.sy, func(x, y, w, h int) {
+			driver.FillRect(x, y, w, h, c)
+		})
+	})
+}
+
+// glyphs calls draw for the characters of a line that starts at x, with the font and glyph used to render each
+// character, the x coordinate of the glyph and the index of the character in the line
+func (l *TextLayout) glyphs(ln textLine, x float64, draw func(gf *Font, idx int, gx float64, i int)) {
+	o := &l.opts
+	font := l.font
+	px := 0.0
+	var prev rune = -1
+	i := 0
+	for _, ch := range ln.text {
+		if ch == '\t' {
+			px = float64((int(px)/o.tabWidth + 1) * o.tabWidth)
+			prev = -1
+			i++
+			continue
+		}
+		if ch == ' ' {
+			px += ln.gap
+		}
+		if prev >= 0 {
+			px += float64(font.Kerning(prev, ch))
+		}
+		m := font.GlyphMetrics(ch)
+		gx := x + (px+float64(m.Bearing))*o.sx
+		if gx > width {
+			break
+		}
+		gf, idx := font.glyph(ch)
+		draw(gf, idx, gx, i)
+		px += float64(m.Advance)
+		prev = ch
+		i++
+	}
+}
+
+// drawOutline renders a 1 pixel outline around the characters of a line with the top left of the line at x, y.
+// The characters are rendered once into a mask of the line, the outline covers the pixels next to the mask.
+func (l *TextLayout) drawOutline(ln textLine, x, y float64, c Color) {
+	o := &l.opts
+	font := l.font
+
+	// The mask covers the glyphs of the line and the outline around them, clipped to the surface
+	left, right := math.MaxInt32, math.MinInt32
+	l.glyphs(ln, x, func(gf *Font, idx int, gx float64, i int) {
+		left = min(left, int(gx+0.5))
+		right = max(right, int(gx+0.5)+int(float64(gf.W)*o.sx+0.5))
+	})
+	if left > right {
+		return
+	}
+	top := int(y+0.5) - 1
+	mx0, my0 := max(left-1, -1), max(top, -1)
+	mx1, my1 := min(right+1, int(width)+1), min(top+int(float64(font.H)*o.sy+0.5)+2, int(height)+1)
+	mw, mh := mx1-mx0, my1-my0
+	if mw <= 0 || mh <= 0 {
+		return
+	}
+	if cap(l.mask) < mw*mh {
+		l.mask = make([]bool, mw*mh)
+	}
+	mask := l.mask[:mw*mh]
+	for i := range mask {
+		mask[i] = false
+	}
+	l.glyphs(ln, x, func(gf *Font, idx int, gx float64, i int) {
+		glyphRuns(gf, idx, int(gx+0.5), int(y+0.5), o.sx, o.sy, func(x, y, w, h int) {
+			for py := max(y, my0); py < min(y+h, my1); py++ {
+				for px := max(x, mx0); px < min(x+w, mx1); px++ {
+					mask[(py-my0)*mw+px-mx0] = true
+				}
+			}
+		})
+	})
+
+	set := func(px, py int) bool {
+		return px >= 0 && px < mw && py >= 0 && py < mh && mask[py*mw+px]
+	}
+	for py := 0; py < mh; py++ {
+		start := -1
+		for px := 0; px <= mw; px++ {
+			edge := false
+			if px < mw && !mask[py*mw+px] {
+				for dy := -1; dy <= 1 && !edge; dy++ {
+					edge = set(px-1, py+dy) || set(px, py+dy) || set(px+1, py+dy)
+				}
+			}
+			if edge && start < 0 {
+				start = px
+			} else if !edge && start >= 0 {
+				driver.FillRect(mx0+start, my0+py, px-start, 1, c)
+				start = -1
+			}
+		}
+	}
+}
+
+// glyphRuns calls fill with the rectangle of each horizontal run of set pixels of a glyph scaled by sx, sy
+// with the top left of the glyph at x0, y0
+func glyphRuns(font *Font, glyph int, x0, y0 int, sx, sy float64, fill func(x, y, w, h int)) {
+	rb := font.rowBytes()
+	row := glyph * font.glyphBytes()
+	for i := 0; i < font.H; i++ {
+		top := y0 + int(float64(i)*sy)
+		h := y0 + int(float64(i+1)*sy) - top
+		start := -1
+		for j := 0; j <= font.W; j++ {
+			set := j < font.W && font.data[row+j/8]&(0x80>>(j%8)) != 0
+			if set && start < 0 {
+				start = j
+			} else if !set && start >= 0 {
+				left := x0 + int(float64(start)*sx)
+				right := x0 + int(float64(j)*sx)
+				fill(left, top, right-left, h)
+				start = -1
+			}
+		}
+		row += rb
+	}
+}
+
+// MeasureString returns the size of the area covered when rendering str with the specified font
+func MeasureString(font *Font, str string, opts ...TextOption) (w, h float64) {
+	return LayoutText(font, 0, 0, str, opts...).Size()
+}
+
+// DrawText renders str in a box of w by h pixels with the top left of the box at x, y.
+// A width or height of 0 does not constrain the text in that direction. The background color can be Transparent.
+func DrawText(font *Font, x, y, w, h float64, str string, bk, fg Color, opts ...TextOption) {
+	LayoutText(font, w, h, str, opts...).Draw(x, y, bk, fg)
+}
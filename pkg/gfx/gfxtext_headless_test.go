@@ -0,0 +1,110 @@
+//go:build headless
+// +build headless
+
+package gfx
+
+import "testing"
+
+func TestDrawStringWithoutOptionsDoesNotAllocate(t *testing.T) {
+	if err := InitWithConfig(Config{Width: 64, Height: 48}); err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		DrawString(Font8x8, 1, 2, "Hello\tWorld", Black, White)
+	})
+	if allocs != 0 {
+		t.Errorf("DrawString allocated %v times", allocs)
+	}
+}
+
+func TestTextOutlineMatchesOffsetText(t *testing.T) {
+	if err := InitWithConfig(Config{Width: 96, Height: 48}); err != nil {
+		t.Fatal(err)
+	}
+	hd := driver.(*headlessDriver)
+	tests := []struct {
+		x, y float64
+		opts []TextOption
+	}{
+		{4, 4, nil},
+		{-3, -2, nil},
+		{60, 30, []TextOption{TextScale(2, 2)}},
+		{2, 20, []TextOption{TextScale(1.5, 1)}},
+	}
+	for _, tt := range tests {
+		l := LayoutText(Font8x8, 0, 0, "Ag\tj!", tt.opts...)
+
+		// The outline is the text drawn in the outline color offset by a pixel in every direction
+		Clear(Black)
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if dx != 0 || dy != 0 {
+					l.drawChars(l.lines[0], tt.x+float64(dx), tt.y+float64(dy), func(int) Color { return Red })
+				}
+			}
+		}
+		l.drawChars(l.lines[0], tt.x, tt.y, func(int) Color { return White })
+		want := append([]Color(nil), hd.backBuffer...)
+
+		Clear(Black)
+		DrawString(Font8x8, tt.x, tt.y, "Ag\tj!", Transparent, White, append(tt.opts, TextOutline(Red))...)
+		for i, c := range hd.backBuffer {
+			if c != want[i] {
+				t.Errorf("text at %v, %v: pixel %d, %d = %v, want %v", tt.x, tt.y, i%96, i/96, c, want[i])
+				break
+			}
+		}
+	}
+}
+
+// setGlyphPixels renders a glyph a pixel at a time, the way glyphs were rendered before they were drawn in runs
+func setGlyphPixels(font *Font, ch rune, x, y int, bk, fg Color) {
+	g := font.Glyph(ch)
+	rb := font.rowBytes()
+	for i := 0; i < font.H; i++ {
+		for j := 0; j < font.W; j++ {
+			if g[i*rb+j/8]&(0x80>>(j%8)) != 0 {
+				driver.SetPixel(x+j, y+i, fg)
+			} else if bk != Transparent {
+				driver.SetPixel(x+j, y+i, bk)
+			}
+		}
+	}
+}
+
+func TestDrawRuneMatchesPixels(t *testing.T) {
+	if err := InitWithConfig(Config{Width: 48, Height: 32}); err != nil {
+		t.Fatal(err)
+	}
+	hd := driver.(*headlessDriver)
+	tests := []struct {
+		font *Font
+		ch   rune
+		x, y int
+		bk   Color
+		bold bool
+	}{
+		{Font8x8, 'W', 3, 4, Blue, false},
+		{Font8x16, '@', -3, -5, Transparent, false},
+		{Font4x6, 'g', 40, 28, Blue, false},
+		{Font8x8, 'R', 10, 10, Transparent, true},
+	}
+	for _, tt := range tests {
+		Clear(Black)
+		setGlyphPixels(tt.font, tt.ch, tt.x, tt.y, tt.bk, White)
+		if tt.bold {
+			setGlyphPixels(tt.font, tt.ch, tt.x+1, tt.y, tt.bk, White)
+		}
+		want := append([]Color(nil), hd.backBuffer...)
+
+		Clear(Black)
+		gf, idx := tt.font.glyph(tt.ch)
+		drawGlyph(gf, idx, tt.x, tt.y, tt.bold, tt.bk, White)
+		for i, c := range hd.backBuffer {
+			if c != want[i] {
+				t.Errorf("%q at %d, %d: pixel %d, %d = %v, want %v", tt.ch, tt.x, tt.y, i%48, i/48, c, want[i])
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package gfx
+
+import "testing"
+
+func TestEllipsisClippedToWidth(t *testing.T) {
+	for _, w := range []float64{0, 7, 8, 16, 24, 32} {
+		l := LayoutText(Font8x8, w, 0, "Hello", Ellipsis())
+		got, _ := l.Size()
+		if w > 0 && got > w {
+			t.Errorf("width %v: text %q is %v pixels wide", w, l.lines[0].text, got)
+		}
+	}
+	if l := LayoutText(Font8x8, 16, 0, "Hello", Ellipsis()); l.lines[0].text != ".." {
+		t.Errorf("text in 16 pixels = %q, want ..", l.lines[0].text)
+	}
+}
+
+func TestMeasureTabsOfFontWithoutWidth(t *testing.T) {
+	f := &Font{H: 8, FirstChar: 'a', LastChar: 'a', data: make([]byte, 8)}
+	if w, _ := MeasureString(f, "a\ta"); w != defaultTabSize {
+		t.Errorf("width = %v, want a tab stop at %v", w, defaultTabSize)
+	}
+}
@@ -0,0 +1,144 @@
+package gfx
+
+import (
+	"math"
+	"sync"
+)
+
+// ScaleMode defines how the graphics surface is presented when the size of the window changes
+type ScaleMode int
+
+// Scale modes
+const (
+	// ScaleInteger scales the surface by the largest integer scale that fits the window, and centres it with black
+	// bars around it. This keeps every pixel the same size, which suits pixel art. When the horizontal and vertical
+	// scales differ, the largest integer multiple of the scale that fits is used to keep the aspect ratio of the
+	// pixels. When the window is too small for that, the largest integer scale with square pixels that fits is used.
+	ScaleInteger ScaleMode = iota
+
+	// ScaleAspect scales the surface to fill as much of the window as possible while keeping its aspect ratio,
+	// and centres it with black bars around it
+	ScaleAspect
+
+	// ScaleStretch stretches the surface to fill the window
+	ScaleStretch
+
+	// ScaleResize keeps the scale of the surface and grows or shrinks the surface to fill the window. Width and
+	// Height return the new size of the surface from the update frame after the resize event.
+	ScaleResize
+)
+
+// viewport is the area of the window, in window pixels, that the graphics surface is presented in
+type viewport struct {
+	x, y int
+	w, h int
+}
+
+// scaledView returns the viewport of a w x h surface scaled by sx, sy in the top left corner of the window
+func scaledView(w, h, sx, sy int) viewport {
+	return viewport{w: w * sx, h: h * sy}
+}
+
+// layoutView returns the viewport of a w x h surface with a scale of sx, sy in a window of winW x winH pixels,
+// and the size of the surface, which only differs from w x h in ScaleResize mode
+func layoutView(mode ScaleMode, winW, winH, w, h, sx, sy int) (v viewport, sw, sh int) {
+	sw, sh = w, h
+	fx, fy := float64(winW)/float64(w*sx), float64(winH)/float64(h*sy)
+	switch mode {
+	case ScaleInteger:
+		// Square pixels take any integer scale that fits, pixels with an aspect ratio keep it with multiples of
+		// the scale. Below the scale of the surface the pixels are square, down to one window pixel per surface pixel.
+		kx := integerFit(winW, winH, w, h)
+		ky := kx
+		if k := int(math.Min(fx, fy)); sx != sy && k >= 1 {
+			kx, ky = k*sx, k*sy
+		}
+		v = centredView(winW, winH, w*kx, h*ky)
+	case ScaleAspect:
+		f := math.Min(fx, fy)
+		v = centredView(winW, winH, int(float64(w*sx)*f+0.5), int(float64(h*sy)*f+0.5))
+	case ScaleStretch:
+		v = viewport{w: winW, h: winH}
+	case ScaleResize:
+		sw, sh = winW/sx, winH/sy
+		if sw < 1 {
+			sw = 1
+		}
+		if sh < 1 {
+			sh = 1
+		}
+		v = scaledView(sw, sh, sx, sy)
+	}
+	if v.w < 1 {
+		v.w = 1
+	}
+	if v.h < 1 {
+		v.h = 1
+	}
+	return v, sw, sh
+}
+
+// integerFit returns the largest integer scale at which a w x h surface fits a window of winW x winH pixels,
+// the scale is at least 1 even when the surface does not fit
+func integerFit(winW, winH, w, h int) int {
+	s := winW / w
+	if sy := winH / h; sy < s {
+		s = sy
+	}
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
+// centredView returns a viewport of w x h pixels centred in a window of winW x winH pixels
+func centredView(winW, winH, w, h int) viewport {
+	return viewport{x: (winW - w) / 2, y: (winH - h) / 2, w: w, h: h}
+}
+
+// dpiScale returns the integer scale that keeps the apparent size of the window on a display with the
+// specified pixels per inch, relative to the 96 pixels per inch of a standard display
+func dpiScale(dpi float64) int {
+	s := int(dpi/96 + 0.5)
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
+// surfaceResize passes a new size of the surface from the event loop, where the window is resized, to the
+// update loop, which owns the back buffer
+type surfaceResize struct {
+	mu      sync.Mutex
+	w, h    int
+	pending bool
+}
+
+// request asks the update loop to resize the surface
+func (r *surfaceResize) request(w, h int) {
+	r.mu.Lock()
+	r.w, r.h, r.pending = w, h, true
+	r.mu.Unlock()
+}
+
+// take returns the size the surface should be resized to, ok is false if the size did not change
+func (r *surfaceResize) take() (w, h int, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ok = r.pending
+	r.pending = false
+	return r.w, r.h, ok
+}
+
+// SetScaleMode sets how the graphics surface is presented when the size of the window changes.
+// The default is ScaleInteger, or the mode set by Config.ScaleMode.
+func SetScaleMode(mode ScaleMode) {
+	driver.SetScaleMode(mode)
+}
+
+// setSurfaceSize sets the size of the surface returned by Width and Height, it is called by the driver from the
+// update loop when it resizes the back buffer
+func setSurfaceSize(w, h int) {
+	width = float64(w)
+	height = float64(h)
+}
@@ -0,0 +1,249 @@
+package input
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/taylorza/go-gfx/pkg/gfx"
+)
+
+// ErrInvalidBinding is returned when a saved binding cannot be loaded
+var ErrInvalidBinding = errors.New("input: invalid binding")
+
+// Source is the input that provides the value of a binding
+type Source int
+
+// Binding sources
+const (
+	SourceKey           Source = iota // The key or mouse button of the binding, 1 when pressed
+	SourceMouseX                      // Horizontal motion of the mouse in pixels since the last update frame
+	SourceMouseY                      // Vertical motion of the mouse in pixels since the last update frame
+	SourceWheelX                      // Notches the mouse wheel was scrolled right since the last update frame
+	SourceWheelY                      // Notches the mouse wheel was scrolled up since the last update frame
+	SourceGamepadButton               // The gamepad button of the binding, 1 when pressed
+	SourceGamepadAxis                 // The position of the gamepad axis of the binding
+)
+
+var sourceNames = map[Source]string{
+	SourceKey:    "key",
+	SourceMouseX: "mouse_x",
+	SourceMouseY: "mouse_y",
+	SourceWheelX: "wheel_x",
+	SourceWheelY: "wheel_y",
+
+	SourceGamepadButton: "gamepad_button",
+	SourceGamepadAxis:   "gamepad_axis",
+}
+
+// String returns the name of the source used when bindings are saved
+func (s Source) String() string {
+	if name, ok := sourceNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Source(%d)", int(s))
+}
+
+// modifierKeys are the keys that are treated as modifiers when a binding is captured
+var modifierKeys = []gfx.Key{
+	gfx.KeyShift, gfx.KeyControl, gfx.KeyAlt, gfx.KeySuper,
+	gfx.KeyLeftShift, gfx.KeyRightShift, gfx.KeyLeftControl, gfx.KeyRightControl,
+	gfx.KeyLeftAlt, gfx.KeyRightAlt, gfx.KeyLeftSuper, gfx.KeyRightSuper,
+}
+
+// Binding binds a key, mouse button or analog source to an action
+type Binding struct {
+	// Key is the key or mouse button of bindings with the SourceKey source
+	Key gfx.Key
+
+	// Modifiers are the keys that must be held for the binding to be active, for example gfx.KeyControl
+	Modifiers []gfx.Key
+
+	// Source is the input that provides the value of the binding
+	Source Source
+
+	// Gamepad is the slot of the gamepad of bindings with a gamepad source
+	Gamepad int
+
+	// Button is the gamepad button of bindings with the SourceGamepadButton source
+	Button gfx.GamepadButton
+
+	// Axis is the gamepad axis of bindings with the SourceGamepadAxis source
+	Axis gfx.GamepadAxis
+
+	// Scale multiplies the value of the source. Use a negative scale for the key of the negative direction of an axis.
+	Scale float64
+}
+
+// Key creates a binding for a key or mouse button, which also moves an axis in the positive direction
+func Key(key gfx.Key) Binding {
+	return Binding{Key: key, Scale: 1}
+}
+
+// Negative creates a binding for a key or mouse button that moves an axis in the negative direction
+func Negative(key gfx.Key) Binding {
+	return Binding{Key: key, Scale: -1}
+}
+
+// Analog creates a binding for an analog source with the value of the source multiplied by scale
+func Analog(source Source, scale float64) Binding {
+	return Binding{Source: source, Scale: scale}
+}
+
+// GamepadButton creates a binding for a button of the gamepad in slot pad
+func GamepadButton(pad int, b gfx.GamepadButton) Binding {
+	return Binding{Source: SourceGamepadButton, Gamepad: pad, Button: b, Scale: 1}
+}
+
+// GamepadAxis creates a binding for an axis of the gamepad in slot pad with the position of the axis multiplied by scale
+func GamepadAxis(pad int, a gfx.GamepadAxis, scale float64) Binding {
+	return Binding{Source: SourceGamepadAxis, Gamepad: pad, Axis: a, Scale: scale}
+}
+
+// With returns a copy of the binding that is only active while the modifier keys are held
+func (b Binding) With(modifiers ...gfx.Key) Binding {
+	b.Modifiers = append(append([]gfx.Key(nil), b.Modifiers...), modifiers...)
+	return b
+}
+
+// String returns a description of the binding for display, for example "Control+S" or "mouse_x"
+func (b Binding) String() string {
+	var sb strings.Builder
+	for _, m := range b.Modifiers {
+		sb.WriteString(m.String())
+		sb.WriteByte('+')
+	}
+	switch b.Source {
+	case SourceKey:
+		sb.WriteString(b.Key.String())
+	case SourceGamepadButton:
+		fmt.Fprintf(&sb, "Gamepad%d.%v", b.Gamepad, b.Button)
+	case SourceGamepadAxis:
+		fmt.Fprintf(&sb, "Gamepad%d.%v", b.Gamepad, b.Axis)
+	default:
+		sb.WriteString(b.Source.String())
+	}
+	return sb.String()
+}
+
+// modifiersHeld returns true if all the modifier keys of the binding are pressed
+func (b *Binding) modifiersHeld() bool {
+	for _, m := range b.Modifiers {
+		if !gfx.KeyPressed(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// value returns the value of the binding ignoring the modifiers
+func (b *Binding) value() float64 {
+	switch b.Source {
+	case SourceKey:
+		if gfx.KeyPressed(b.Key) {
+			return b.Scale
+		}
+	case SourceMouseX:
+		dx, _ := gfx.MouseDelta()
+		return dx * b.Scale
+	case SourceMouseY:
+		_, dy := gfx.MouseDelta()
+		return dy * b.Scale
+	case SourceWheelX:
+		dx, _ := gfx.MouseWheel()
+		return dx * b.Scale
+	case SourceWheelY:
+		_, dy := gfx.MouseWheel()
+		return dy * b.Scale
+	case SourceGamepadButton:
+		if gfx.GamepadButtonPressed(b.Gamepad, b.Button) {
+			return b.Scale
+		}
+	case SourceGamepadAxis:
+		return gfx.GamepadAxisValue(b.Gamepad, b.Axis) * b.Scale
+	}
+	return 0
+}
+
+type bindingJSON struct {
+	Key       string   `json:"key,omitempty"`
+	Modifiers []string `json:"modifiers,omitempty"`
+	Source    string   `json:"source,omitempty"`
+	Gamepad   int      `json:"gamepad,omitempty"`
+	Button    string   `json:"button,omitempty"`
+	Axis      string   `json:"axis,omitempty"`
+	Scale     *float64 `json:"scale,omitempty"`
+}
+
+// MarshalJSON encodes the binding using the names of the keys and source
+func (b Binding) MarshalJSON() ([]byte, error) {
+	var j bindingJSON
+	switch b.Source {
+	case SourceKey:
+		j.Key = b.Key.String()
+	case SourceGamepadButton:
+		j.Source, j.Gamepad, j.Button = b.Source.String(), b.Gamepad, b.Button.String()
+	case SourceGamepadAxis:
+		j.Source, j.Gamepad, j.Axis = b.Source.String(), b.Gamepad, b.Axis.String()
+	default:
+		j.Source = b.Source.String()
+	}
+	for _, m := range b.Modifiers {
+		j.Modifiers = append(j.Modifiers, m.String())
+	}
+	if b.Scale != 1 {
+		j.Scale = &b.Scale
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes a binding encoded by MarshalJSON. The scale defaults to 1 when it is omitted.
+func (b *Binding) UnmarshalJSON(data []byte) error {
+	var j bindingJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	nb := Binding{Scale: 1}
+	if j.Scale != nil {
+		nb.Scale = *j.Scale
+	}
+	if j.Source != "" && j.Source != SourceKey.String() {
+		found := false
+		for s, name := range sourceNames {
+			if name == j.Source {
+				nb.Source, found = s, true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: unknown source %q", ErrInvalidBinding, j.Source)
+		}
+	}
+
+	var ok bool
+	switch nb.Source {
+	case SourceKey:
+		if nb.Key, ok = gfx.KeyByName(j.Key); !ok {
+			return fmt.Errorf("%w: unknown key %q", ErrInvalidBinding, j.Key)
+		}
+	case SourceGamepadButton:
+		if nb.Button, ok = gfx.GamepadButtonByName(j.Button); !ok {
+			return fmt.Errorf("%w: unknown gamepad button %q", ErrInvalidBinding, j.Button)
+		}
+	case SourceGamepadAxis:
+		if nb.Axis, ok = gfx.GamepadAxisByName(j.Axis); !ok {
+			return fmt.Errorf("%w: unknown gamepad axis %q", ErrInvalidBinding, j.Axis)
+		}
+	}
+	nb.Gamepad = j.Gamepad
+	for _, name := range j.Modifiers {
+		key, ok := gfx.KeyByName(name)
+		if !ok {
+			return fmt.Errorf("%w: unknown modifier %q", ErrInvalidBinding, name)
+		}
+		nb.Modifiers = append(nb.Modifiers, key)
+	}
+	*b = nb
+	return nil
+}
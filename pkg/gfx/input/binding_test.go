@@ -0,0 +1,35 @@
+package input
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/taylorza/go-gfx/pkg/gfx"
+)
+
+func TestBindingJSONRoundTrip(t *testing.T) {
+	bindings := []Binding{
+		Key(gfx.KeySpace),
+		Key(gfx.KeyUndefined),
+		Key(gfx.Key(0xfe)),
+		Negative(gfx.KeyLeft).With(gfx.KeyControl),
+		Analog(SourceMouseX, 0.5),
+		GamepadButton(1, gfx.GamepadButton(0)),
+		GamepadAxis(0, gfx.GamepadAxis(1), -1),
+	}
+	for _, b := range bindings {
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatalf("%v: %v", b, err)
+		}
+		var got Binding
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Errorf("%v saved as %s: %v", b, data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, b) {
+			t.Errorf("%v saved as %s restored as %v", b, data, got)
+		}
+	}
+}
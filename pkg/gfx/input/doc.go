@@ -0,0 +1,3 @@
+// Package input maps named actions like "jump" or "move_x" to the keys, mouse buttons and mouse motion
+// of the gfx package, so that games can check actions instead of hard-coded keys and let players rebind them.
+package input
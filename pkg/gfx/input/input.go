@@ -0,0 +1,235 @@
+package input
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/taylorza/go-gfx/pkg/gfx"
+)
+
+// Map holds a set of named actions and the bindings that trigger them.
+//
+// A binding with modifiers takes precedence over bindings of the same key with fewer modifiers,
+// so when "save" is bound to Control+S and "down" to S, pressing Control+S only triggers "save".
+type Map struct {
+	actions map[string]*action
+}
+
+type action struct {
+	bindings []Binding
+	deadZone float64
+}
+
+// NewMap creates an empty action map
+func NewMap() *Map {
+	return &Map{
+		actions: make(map[string]*action),
+	}
+}
+
+func (m *Map) action(name string) *action {
+	a, ok := m.actions[name]
+	if !ok {
+		a = &action{}
+		m.actions[name] = a
+	}
+	return a
+}
+
+// Bind adds bindings to an action, creating the action if it does not exist
+func (m *Map) Bind(name string, bindings ...Binding) {
+	a := m.action(name)
+	a.bindings = append(a.bindings, bindings...)
+}
+
+// Rebind replaces the bindings of an action, for example after the player selected a new key
+func (m *Map) Rebind(name string, bindings ...Binding) {
+	a := m.action(name)
+	a.bindings = append([]Binding(nil), bindings...)
+}
+
+// Unbind removes an action and its bindings
+func (m *Map) Unbind(name string) {
+	delete(m.actions, name)
+}
+
+// Bindings returns a copy of the bindings of an action
+func (m *Map) Bindings(name string) []Binding {
+	if a, ok := m.actions[name]; ok {
+		return append([]Binding(nil), a.bindings...)
+	}
+	return nil
+}
+
+// Actions returns the names of the actions in the map in sorted order
+func (m *Map) Actions() []string {
+	names := make([]string, 0, len(m.actions))
+	for name := range m.actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetDeadZone sets the magnitude below which the value of an action is reported as 0.
+// This filters small unintended motion of analog sources.
+func (m *Map) SetDeadZone(name string, deadZone float64) {
+	m.action(name).deadZone = deadZone
+}
+
+// DeadZone returns the dead zone of an action
+func (m *Map) DeadZone(name string) float64 {
+	if a, ok := m.actions[name]; ok {
+		return a.deadZone
+	}
+	return 0
+}
+
+// Value returns the sum of the values of the active bindings of an action. Keys contribute the scale of their
+// binding while pressed, so an axis bound with Negative(gfx.KeyLeft) and Key(gfx.KeyRight) is -1, 0 or 1.
+// Values with a magnitude that does not exceed the dead zone of the action are reported as 0.
+func (m *Map) Value(name string) float64 {
+	a, ok := m.actions[name]
+	if !ok {
+		return 0
+	}
+	v := 0.0
+	for i := range a.bindings {
+		if m.active(&a.bindings[i]) {
+			v += a.bindings[i].value()
+		}
+	}
+	if math.Abs(v) <= a.deadZone {
+		return 0
+	}
+	return v
+}
+
+// Pressed returns true if any binding of an action is active. Analog bindings are active when the magnitude
+// of their value exceeds the dead zone of the action.
+func (m *Map) Pressed(name string) bool {
+	a, ok := m.actions[name]
+	if !ok {
+		return false
+	}
+	for i := range a.bindings {
+		b := &a.bindings[i]
+		if m.active(b) && math.Abs(b.value()) > a.deadZone {
+			return true
+		}
+	}
+	return false
+}
+
+// JustPressed returns true if the key or gamepad button of any binding of an action was pressed since the
+// last update frame while the modifiers of the binding are held
+func (m *Map) JustPressed(name string) bool {
+	a, ok := m.actions[name]
+	if !ok {
+		return false
+	}
+	for i := range a.bindings {
+		b := &a.bindings[i]
+		switch {
+		case b.Source == SourceKey && gfx.KeyJustPressed(b.Key) && m.active(b):
+			return true
+		case b.Source == SourceGamepadButton && gfx.GamepadButtonJustPressed(b.Gamepad, b.Button) && m.active(b):
+			return true
+		}
+	}
+	return false
+}
+
+// active returns true if the modifiers of the binding are held and no binding of the same key
+// with more modifiers is active
+func (m *Map) active(b *Binding) bool {
+	if !b.modifiersHeld() {
+		return false
+	}
+	if b.Source != SourceKey {
+		return true
+	}
+	for _, a := range m.actions {
+		for i := range a.bindings {
+			o := &a.bindings[i]
+			if o.Source == SourceKey && o.Key == b.Key && len(o.Modifiers) > len(b.Modifiers) && o.modifiersHeld() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Capture returns a binding for the key or mouse button pressed since the last update frame, including the
+// modifier keys that are held. Call Capture every update frame while waiting for the player to press the new
+// key of an action, and pass the binding to Rebind.
+func Capture() (Binding, bool) {
+	for k := 1; k < 256; k++ {
+		key := gfx.Key(k)
+		if isModifier(key) || !gfx.KeyJustPressed(key) {
+			continue
+		}
+		b := Key(key)
+		for _, m := range []gfx.Key{gfx.KeyControl, gfx.KeyAlt, gfx.KeyShift, gfx.KeySuper} {
+			if gfx.KeyPressed(m) {
+				b.Modifiers = append(b.Modifiers, m)
+			}
+		}
+		return b, true
+	}
+	return Binding{}, false
+}
+
+func isModifier(key gfx.Key) bool {
+	for _, m := range modifierKeys {
+		if key == m {
+			return true
+		}
+	}
+	return false
+}
+
+type actionJSON struct {
+	Bindings []Binding `json:"bindings"`
+	DeadZone float64   `json:"dead_zone,omitempty"`
+}
+
+// MarshalJSON encodes the actions of the map as a JSON object keyed by action name
+func (m *Map) MarshalJSON() ([]byte, error) {
+	j := make(map[string]actionJSON, len(m.actions))
+	for name, a := range m.actions {
+		j[name] = actionJSON{Bindings: a.bindings, DeadZone: a.deadZone}
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes actions encoded by MarshalJSON. The decoded actions replace the actions with the
+// same name, other actions in the map keep their bindings.
+func (m *Map) UnmarshalJSON(data []byte) error {
+	var j map[string]actionJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if m.actions == nil {
+		m.actions = make(map[string]*action)
+	}
+	for name, a := range j {
+		m.actions[name] = &action{bindings: a.Bindings, deadZone: a.DeadZone}
+	}
+	return nil
+}
+
+// Save writes the actions of the map to w as JSON
+func (m *Map) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// Load reads actions written by Save from r. The loaded actions replace the actions with the same name,
+// so the default bindings of a game can be set up before loading the bindings saved by the player.
+func (m *Map) Load(r io.Reader) error {
+	return json.NewDecoder(r).Decode(m)
+}